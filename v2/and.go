@@ -11,43 +11,73 @@ package packrat
 type AndParser[T any] struct {
 	callback func(string, ...T) T
 	subParser []Parser[T]
-	buf []T
-	depth int
+	contextCallback func(Context[T], string, ...T) (T, error)
 }
 
 // NewAndParser constructs a new AndParser with the given sub parsers. An AndParser accepts an input if all sub parsers accept the input sequentially.
+// The payload slice passed to the callback is only valid during the call; copy it to keep it.
 func NewAndParser[T any](callback func(string, ...T) T, subparser ...Parser[T]) *AndParser[T] {
-	return &AndParser[T]{callback: callback, subParser: subparser, buf: make([]T, len(subparser))}
+	return &AndParser[T]{callback: callback, subParser: subparser}
 }
 
 // Set updates the sub parsers. This can be used to construct recursive parsers.
 func (p *AndParser[T]) Set(embedded ...Parser[T]) {
 	p.subParser = embedded
-	p.buf = make([]T, len(embedded))
+}
+
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). It replaces the callback
+// given to the constructor.
+func (p *AndParser[T]) SetContextCallback(callback func(Context[T], string, ...T) (T, error)) {
+	p.contextCallback = callback
 }
 
 // Match matches all given parsers sequentially.
 func (p *AndParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
-	var nodes []T
-	if p.depth == 0 {
-		nodes = p.buf[:0]
-	} else {
-		nodes = make([]T, 0, len(p.subParser))
-	}
-	p.depth++
 	start := s.position
 	startPosition := s.position
+	mark := s.deferMark()
+	argMark := len(s.args)
 	for _, c := range p.subParser {
 		node, ok := s.applyRule(c)
 		if !ok {
+			s.deferDrop(mark)
+			s.args = s.args[:argMark]
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+		if s.deferred != nil {
+			s.deferChild(node)
+		} else {
+			s.args = append(s.args, node.Payload)
+		}
+	}
+	if s.deferred != nil {
+		if p.contextCallback == nil {
+			return s.deferMatch(p, s.input[start:], s.position-start, start, mark), true
+		}
+		// the callback can fail, so it runs now (see SetDeferred)
+		if !s.resolveChildren(mark) {
+			s.args = s.args[:argMark]
 			s.setPosition(startPosition)
-			p.depth--
 			return Node[T]{}, false
 		}
-		nodes = append(nodes, node.Payload)
 	}
 
-	result := Node[T]{Payload: p.callback(s.input[start:s.position], nodes...)}
-	p.depth--
-	return result, true
+	nodes := s.args[argMark:]
+	var result Node[T]
+	ok := true
+	if p.contextCallback != nil {
+		ctx := s.context(s.tokenStart(start), s.position)
+		v, err := p.contextCallback(ctx, s.input[start:s.position], nodes...)
+		result, ok = s.callbackResult(v, err, ctx.Span, startPosition)
+	} else {
+		result = Node[T]{Payload: p.callback(s.input[start:s.position], nodes...)}
+	}
+	s.args = s.args[:argMark]
+	return result, ok
+}
+
+func (p *AndParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	return p.callback(d.input[:d.n], args...)
 }
@@ -16,6 +16,8 @@ type AtomParser[T any] struct {
 	skipWs          bool
 	atom            string
 	caseInsensitive bool
+	fold            *atomFold
+	contextCallback func(Context[T], string) (T, error)
 }
 
 func NewAtomParser[T any](value T, str string, caseInsensitive bool, skipWs bool) *AtomParser[T] {
@@ -23,8 +25,18 @@ func NewAtomParser[T any](value T, str string, caseInsensitive bool, skipWs bool
 	return p
 }
 
+// SetContextCallback installs a callback that computes the payload from the
+// context of the match and the matched text instead of the fixed value (see
+// Context).
+func (p *AtomParser[T]) SetContextCallback(callback func(Context[T], string) (T, error)) {
+	p.contextCallback = callback
+}
+
 // Match matches only the given string. If skipWs is set to true, leading whitespace according to the scanner's skip regexp is skipped, but not matched by the parser.
 func (p *AtomParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
 	startPosition := s.position
 
 	if p.skipWs {
@@ -36,6 +48,23 @@ func (p *AtomParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 		}
 	}
 
+	if p.fold != nil {
+		n := p.fold.match(s.remainingInput)
+		if n < 0 {
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+		s.move(n)
+		if p.skipWs && !s.isAtBreak() {
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+		if p.contextCallback != nil {
+			return p.result(s, s.position-n, startPosition)
+		}
+		return Node[T]{Payload: p.value}, true
+	}
+
 	atomLen := len(p.atom)
 	if len(s.remainingInput) < atomLen {
 		s.setPosition(startPosition)
@@ -62,5 +91,15 @@ func (p *AtomParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 		}
 	}
 
+	if p.contextCallback != nil {
+		return p.result(s, s.position-atomLen, startPosition)
+	}
 	return Node[T]{Payload: p.value}, true
 }
+
+// result runs the context callback for the match from start.
+func (p *AtomParser[T]) result(s *Scanner[T], start, startPosition int) (Node[T], bool) {
+	ctx := s.context(start, s.position)
+	v, err := p.contextCallback(ctx, s.input[start:s.position])
+	return s.callbackResult(v, err, ctx.Span, startPosition)
+}
@@ -0,0 +1,169 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// FoldOptions configures atoms created by NewAtomParserFold.
+type FoldOptions struct {
+	// Turkic additionally folds the Turkish dotless ı and dotted İ to i, so
+	// that keywords upper- or lowercased under a Turkish locale still match.
+	Turkic bool
+
+	// Normalize, if set, is applied to the atom and to every grapheme of the
+	// input (a starter followed by its combining marks) before folding. Pass
+	// norm.NFC.String from golang.org/x/text/unicode/norm so that composed
+	// and decomposed spellings match each other.
+	Normalize func(string) string
+}
+
+// atomFold matches rune by rune under full Unicode case folding. The match
+// may consume more or fewer bytes than the atom has, e.g. "STRASSE" matches
+// "straße" and "ſ" (long s) matches "s".
+type atomFold struct {
+	folded    []rune
+	turkic    bool
+	normalize func(string) string
+}
+
+// NewAtomParserFold constructs an atom that compares case-insensitively by
+// full Unicode case folding instead of byte-wise ASCII folding.
+func NewAtomParserFold[T any](value T, str string, skipWs bool, opts FoldOptions) *AtomParser[T] {
+	f := &atomFold{turkic: opts.Turkic, normalize: opts.Normalize}
+	var buf [8]rune
+	for i := 0; i < len(str); {
+		n := f.segment(str[i:])
+		f.folded = append(f.folded, f.foldSegment(str[i:i+n], buf[:0])...)
+		i += n
+	}
+	return &AtomParser[T]{value: value, skipWs: skipWs, atom: str, caseInsensitive: true, fold: f}
+}
+
+// match returns the number of bytes of input that fold to the atom or -1.
+func (f *atomFold) match(input string) int {
+	var buf [8]rune
+	i := 0
+	pos := 0
+	for i < len(f.folded) {
+		if pos >= len(input) {
+			return -1
+		}
+		n := f.segment(input[pos:])
+		folded := f.foldSegment(input[pos:pos+n], buf[:0])
+		if len(folded) > len(f.folded)-i {
+			return -1 // the input character folds to more than what is left
+		}
+		for _, r := range folded {
+			if r != f.folded[i] {
+				return -1
+			}
+			i++
+		}
+		pos += n
+	}
+	return pos
+}
+
+// segment returns the byte length of the next unit that is folded as a
+// whole: a single rune, or a grapheme if normalization is enabled.
+func (f *atomFold) segment(input string) int {
+	_, n := utf8.DecodeRuneInString(input)
+	if f.normalize == nil {
+		return n
+	}
+	for n < len(input) {
+		r, size := utf8.DecodeRuneInString(input[n:])
+		if !unicode.Is(unicode.M, r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+func (f *atomFold) foldSegment(seg string, buf []rune) []rune {
+	if f.normalize != nil && len(seg) > 1 {
+		seg = f.normalize(seg)
+	}
+	for _, r := range seg {
+		buf = f.foldRune(r, buf)
+	}
+	return buf
+}
+
+// foldRune appends the case folding of r to buf. Runes that fold to several
+// runes (ß → ss) are expanded; all others map to the smallest rune of their
+// simple folding orbit, so K, k and the Kelvin sign fold alike.
+func (f *atomFold) foldRune(r rune, buf []rune) []rune {
+	if r < utf8.RuneSelf {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		return append(buf, r)
+	}
+	if f.turkic && (r == 'ı' || r == 'İ') {
+		return append(buf, 'I')
+	}
+	if expansion, ok := fullFolds[r]; ok {
+		for _, e := range expansion {
+			buf = f.foldRune(e, buf)
+		}
+		return buf
+	}
+	min := r
+	for c := unicode.SimpleFold(r); c != r; c = unicode.SimpleFold(c) {
+		if c < min {
+			min = c
+		}
+	}
+	return append(buf, min)
+}
+
+// fullFolds lists the length-changing foldings of CaseFolding.txt (status F)
+// that occur in practice.
+var fullFolds = map[rune]string{
+	'\u00DF': "ss",      // ß
+	'\u1E9E': "ss",      // ẞ
+	'\u0130': "i\u0307", // İ
+	'\u0149': "\u02BCn", // ŉ
+	'\u01F0': "j\u030C", // ǰ
+	'\u1E96': "h\u0331", // ẖ
+	'\u1E97': "t\u0308", // ẗ
+	'\u1E98': "w\u030A", // ẘ
+	'\u1E99': "y\u030A", // ẙ
+	'\u1E9A': "a\u02BE", // ẚ
+	'\uFB00': "ff",      // ﬀ
+	'\uFB01': "fi",      // ﬁ
+	'\uFB02': "fl",      // ﬂ
+	'\uFB03': "ffi",     // ﬃ
+	'\uFB04': "ffl",     // ﬄ
+	'\uFB05': "st",      // ﬅ
+	'\uFB06': "st",      // ﬆ
+}
+
+// firstBytes adds the bytes a folded match can start with.
+func (f *atomFold) firstBytes(bytes *[256]bool) {
+	if len(f.folded) == 0 || f.normalize != nil {
+		fillAllBytes(bytes)
+		return
+	}
+	first := f.folded[0]
+	for r := rune(0); r < utf8.RuneSelf; r++ {
+		var buf [1]rune
+		if f.foldRune(r, buf[:0])[0] == first {
+			bytes[r] = true
+		}
+	}
+	// any non-ASCII rune may fold to an ASCII one (K → k, ſ → s)
+	for b := utf8.RuneSelf; b < 256; b++ {
+		bytes[b] = true
+	}
+}
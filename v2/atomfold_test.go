@@ -0,0 +1,95 @@
+package packrat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAtomFoldLengthChanging(t *testing.T) {
+	tests := []struct {
+		atom  string
+		input string
+		ok    bool
+	}{
+		{"STRASSE", "straße", true},
+		{"straße", "STRASSE", true},
+		{"straße", "STRAẞE", true},
+		{"s", "ß", false},
+		{"ss", "ß", true},
+		{"sun", "ſun", true},
+		{"kelvin", "\u212Aelvin", true},
+		{"Ärger", "äRGER", true},
+		{"office", "oﬃce", true},
+		{"INSERT", "İNSERT", false},
+	}
+	for _, tt := range tests {
+		p := NewAtomParserFold(1, tt.atom, false, FoldOptions{})
+		scanner := NewScanner[int](tt.input, nil)
+		_, err := Parse[int](p, scanner)
+		if tt.ok && err != nil {
+			t.Errorf("%q should match %q: %s", tt.atom, tt.input, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("%q should not match %q", tt.atom, tt.input)
+		}
+	}
+}
+
+func TestAtomFoldTurkic(t *testing.T) {
+	p := NewAtomParserFold(1, "insert", true, FoldOptions{Turkic: true})
+	for _, input := range []string{"İNSERT", "ınsert", "INSERT"} {
+		if _, err := Parse[int](p, NewScanner[int](input, SkipWhitespaceRegex)); err != nil {
+			t.Errorf("turkic atom should match %q: %s", input, err)
+		}
+	}
+}
+
+func TestAtomFoldSpan(t *testing.T) {
+	// the consumed span has a different length than the atom
+	p := NewAndParser(func(s string, a ...string) string { return s }, NewAtomParserFold("", "STRASSE", true, FoldOptions{}), NewAtomParser("", "1", false, true))
+	n, err := Parse[string](p, NewScanner[string]("  Straße 1", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != "  Straße 1" {
+		t.Errorf("unexpected match %q", n.Payload)
+	}
+
+	// the word boundary is checked after the folded match
+	if _, err := Parse[string](p, NewScanner[string]("Straßen 1", SkipWhitespaceRegex)); err == nil {
+		t.Error("atom should not match inside a longer word")
+	}
+}
+
+func TestAtomFoldNormalize(t *testing.T) {
+	// a tiny stand-in for norm.NFC.String
+	nfc := strings.NewReplacer("e\u0301", "\u00e9", "E\u0301", "\u00c9").Replace
+	p := NewAtomParserFold(1, "caf\u00e9", false, FoldOptions{Normalize: nfc})
+	for _, input := range []string{"CAF\u00c9", "cafe\u0301", "CAFE\u0301"} {
+		if _, err := Parse[int](p, NewScanner[int](input, nil)); err != nil {
+			t.Errorf("atom should match %q: %s", input, err)
+		}
+	}
+	decomposed := NewAtomParserFold(1, "cafe\u0301", false, FoldOptions{Normalize: nfc})
+	if _, err := Parse[int](decomposed, NewScanner[int]("CAF\u00c9", nil)); err != nil {
+		t.Errorf("decomposed atom should match the composed input: %s", err)
+	}
+	// the combining mark belongs to the e, so a plain e does not match
+	plain := NewAtomParserFold(1, "cafe", false, FoldOptions{Normalize: nfc})
+	if _, err := ParsePartial[int](plain, NewScanner[int]("cafe\u0301", nil)); err == nil {
+		t.Error("cafe should not match a prefix of caf\u00e9")
+	}
+}
+
+func TestAtomFoldCharMap(t *testing.T) {
+	kelvin := NewAtomParserFold("k", "kelvin", true, FoldOptions{})
+	celsius := NewAtomParserFold("c", "celsius", true, FoldOptions{})
+	or := NewOrParser[string](celsius, kelvin)
+	for input, expected := range map[string]string{"KELVIN": "k", "\u212Aelvin": "k", "Celsius": "c"} {
+		n, err := Parse[string](or, NewScanner[string](input, SkipWhitespaceRegex))
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+		} else if n.Payload != expected {
+			t.Errorf("%q: expected %q, got %q", input, expected, n.Payload)
+		}
+	}
+}
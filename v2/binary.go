@@ -0,0 +1,324 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"encoding/binary"
+	"sync"
+	"unsafe"
+)
+
+// NewBytesScanner constructs a scanner for binary input. The buffer is not
+// copied, so it must not be modified while the scanner is in use. The
+// scanner does not skip anything and does not look for word boundaries;
+// atoms and regexes should be constructed with skipWs = false.
+func NewBytesScanner[T any](input []byte) *Scanner[T] {
+	s := NewScanner[T]("", nil)
+	s.ResetBytes(input)
+	return s
+}
+
+// ResetBytes reinitializes the scanner for a new binary input like Reset.
+func (s *Scanner[T]) ResetBytes(input []byte) {
+	s.binary = true
+	s.skipper = nil
+	s.reset(unsafe.String(unsafe.SliceData(input), len(input)))
+}
+
+// NewMagicParser matches the fixed byte sequence magic, e.g. a file signature.
+func NewMagicParser[T any](value T, magic []byte) *AtomParser[T] {
+	return NewAtomParser(value, string(magic), false, false)
+}
+
+// FixedUintParser matches an unsigned integer of fixed width.
+type FixedUintParser[T any] struct {
+	callback func(uint64) T
+	size     int
+	order    binary.ByteOrder
+	shift    int // sign extension of signed integers
+
+	contextCallback func(Context[T], uint64) (T, error)
+}
+
+// NewFixedUintParser matches an unsigned integer of size 1, 2, 4 or 8 bytes
+// in the given byte order (binary.LittleEndian or binary.BigEndian).
+func NewFixedUintParser[T any](callback func(uint64) T, size int, order binary.ByteOrder) *FixedUintParser[T] {
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		panic("packrat: fixed integers must have 1, 2, 4 or 8 bytes")
+	}
+	return &FixedUintParser[T]{callback: callback, size: size, order: order}
+}
+
+// NewFixedIntParser matches a two's complement signed integer of size 1, 2, 4
+// or 8 bytes in the given byte order.
+func NewFixedIntParser[T any](callback func(int64) T, size int, order binary.ByteOrder) *FixedUintParser[T] {
+	p := NewFixedUintParser(func(v uint64) T {
+		return callback(int64(v))
+	}, size, order)
+	p.shift = 64 - 8*size
+	return p
+}
+
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). Signed integers are passed
+// as uint64 of their value. It replaces the callback given to the
+// constructor.
+func (p *FixedUintParser[T]) SetContextCallback(callback func(Context[T], uint64) (T, error)) {
+	p.contextCallback = callback
+}
+
+// Match reads the integer at the current position.
+func (p *FixedUintParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
+	if len(s.remainingInput) < p.size {
+		return Node[T]{}, false
+	}
+	v := p.decode(s.remainingInput)
+	s.move(p.size)
+	if p.contextCallback != nil {
+		ctx := s.context(s.position-p.size, s.position)
+		result, err := p.contextCallback(ctx, v)
+		return s.callbackResult(result, err, ctx.Span, s.position-p.size)
+	}
+	if s.deferred != nil {
+		return s.deferLeaf(p, s.position-p.size), true
+	}
+	return Node[T]{Payload: p.callback(v)}, true
+}
+
+func (p *FixedUintParser[T]) decode(input string) uint64 {
+	b := unsafe.Slice(unsafe.StringData(input), p.size)
+	var v uint64
+	switch p.size {
+	case 1:
+		v = uint64(b[0])
+	case 2:
+		v = uint64(p.order.Uint16(b))
+	case 4:
+		v = uint64(p.order.Uint32(b))
+	default:
+		v = p.order.Uint64(b)
+	}
+	return uint64(int64(v<<p.shift) >> p.shift)
+}
+
+func (p *FixedUintParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	return p.callback(p.decode(d.input))
+}
+
+// VarintParser matches a variable-length integer as written by
+// binary.PutUvarint or binary.PutVarint.
+type VarintParser[T any] struct {
+	callback func(uint64) T
+	signed   bool // zig-zag encoded
+
+	contextCallback func(Context[T], uint64) (T, error)
+}
+
+// NewUvarintParser matches an unsigned varint.
+func NewUvarintParser[T any](callback func(uint64) T) *VarintParser[T] {
+	return &VarintParser[T]{callback: callback}
+}
+
+// NewVarintParser matches a zig-zag encoded signed varint.
+func NewVarintParser[T any](callback func(int64) T) *VarintParser[T] {
+	return &VarintParser[T]{callback: func(v uint64) T {
+		return callback(int64(v))
+	}, signed: true}
+}
+
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). Signed varints are passed
+// as uint64 of their value. It replaces the callback given to the
+// constructor.
+func (p *VarintParser[T]) SetContextCallback(callback func(Context[T], uint64) (T, error)) {
+	p.contextCallback = callback
+}
+
+// Match reads the varint at the current position. Truncated and overlong
+// varints do not match.
+func (p *VarintParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
+	n := min(len(s.remainingInput), binary.MaxVarintLen64)
+	v, size := p.decode(s.remainingInput[:n])
+	if size <= 0 {
+		return Node[T]{}, false
+	}
+	s.move(size)
+	if p.contextCallback != nil {
+		ctx := s.context(s.position-size, s.position)
+		result, err := p.contextCallback(ctx, v)
+		return s.callbackResult(result, err, ctx.Span, s.position-size)
+	}
+	if s.deferred != nil {
+		return s.deferLeaf(p, s.position-size), true
+	}
+	return Node[T]{Payload: p.callback(v)}, true
+}
+
+func (p *VarintParser[T]) decode(input string) (uint64, int) {
+	v, size := binary.Uvarint(unsafe.Slice(unsafe.StringData(input), len(input)))
+	if p.signed {
+		x := int64(v >> 1)
+		if v&1 != 0 {
+			x = ^x
+		}
+		v = uint64(x)
+	}
+	return v, size
+}
+
+func (p *VarintParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	v, _ := p.decode(d.input[:d.n])
+	return p.callback(v)
+}
+
+// LengthPrefixedParser matches a field whose length in bytes is given by a
+// value parsed before it, e.g. a length prefix or a header field.
+type LengthPrefixedParser[T any] struct {
+	callback func(string, ...T) T
+	length   Parser[T]
+	lengthOf func(T) int
+	body     Parser[T]
+	pool     sync.Pool
+
+	contextCallback func(Context[T], string, ...T) (T, error)
+}
+
+// NewLengthPrefixedParser matches length, takes the field length from its
+// payload with lengthOf and then matches a field of that many bytes. If body
+// is not nil, it has to match the field completely. callback receives the
+// field and the payloads of length and body.
+func NewLengthPrefixedParser[T any](callback func(string, ...T) T, length Parser[T], lengthOf func(T) int, body Parser[T]) *LengthPrefixedParser[T] {
+	return &LengthPrefixedParser[T]{callback: callback, length: length, lengthOf: lengthOf, body: body}
+}
+
+// Set updates the body parser. This can be used to construct recursive
+// parsers.
+func (p *LengthPrefixedParser[T]) Set(body Parser[T]) {
+	p.body = body
+}
+
+// SetContextCallback installs a callback that additionally receives the
+// context of the field and can fail (see Context). It replaces the callback
+// given to the constructor.
+func (p *LengthPrefixedParser[T]) SetContextCallback(callback func(Context[T], string, ...T) (T, error)) {
+	p.contextCallback = callback
+}
+
+// Match matches the length, then the field.
+func (p *LengthPrefixedParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
+	startPosition := s.position
+	lengthNode, ok := s.applyRule(p.length)
+	if !ok {
+		return Node[T]{}, false
+	}
+	if s.deferred != nil {
+		// the length is needed right now, so its callbacks cannot wait
+		lengthNode = Node[T]{Payload: s.resolveNow(lengthNode)}
+		if s.abortErr != nil {
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+	}
+	n := p.lengthOf(lengthNode.Payload)
+	if n < 0 || n > len(s.remainingInput) {
+		s.setPosition(startPosition)
+		return Node[T]{}, false
+	}
+	fieldStart := s.position
+	field := s.remainingInput[:n]
+	if p.body == nil {
+		s.move(n)
+		if s.deferred != nil && p.contextCallback == nil {
+			mark := len(s.deferred.stack)
+			s.deferChild(lengthNode)
+			return s.deferMatch(p, field, n, fieldStart, mark), true
+		}
+		if p.contextCallback != nil {
+			ctx := s.context(fieldStart, s.position)
+			v, err := p.contextCallback(ctx, field, lengthNode.Payload)
+			return s.callbackResult(v, err, ctx.Span, startPosition)
+		}
+		return Node[T]{Payload: p.callback(field, lengthNode.Payload)}, true
+	}
+
+	// the body is matched on a scanner of its own so that it cannot read
+	// beyond the field
+	sub, _ := p.pool.Get().(*Scanner[T])
+	if sub == nil {
+		sub = NewScanner[T]("", nil)
+	}
+	sub.binary = s.binary
+	sub.words = s.words
+	sub.skipper = s.skipper
+	sub.reset(field)
+	sub.parent = s
+	sub.version = s.version
+	sub.UserData = s.UserData
+	sub.deferred = s.deferred
+	sub.trace = s.trace
+	sub.base = fieldStart
+
+	bodyNode, ok := sub.applyRule(p.body)
+	if ok {
+		sub.Skip()
+		ok = len(sub.remainingInput) == 0
+	}
+	if !ok {
+		pos, failedParsers := sub.farthestFailure()
+		if pos < sub.position {
+			pos, failedParsers = sub.position, nil
+		}
+		s.noteEmbedFailure(fieldStart+pos, failedParsers)
+		sub.parent = nil
+		sub.UserData = nil
+		sub.deferred = nil
+		sub.trace = nil
+		p.pool.Put(sub)
+		s.setPosition(startPosition)
+		return Node[T]{}, false
+	}
+	sub.parent = nil
+	sub.UserData = nil
+	sub.deferred = nil
+	sub.trace = nil
+	p.pool.Put(sub)
+	s.move(n)
+	if s.deferred != nil {
+		if p.contextCallback == nil {
+			mark := len(s.deferred.stack)
+			s.deferChild(lengthNode)
+			s.deferChild(bodyNode)
+			return s.deferMatch(p, field, n, fieldStart, mark), true
+		}
+		// the callback can fail, so it runs now (see SetDeferred)
+		bodyNode = Node[T]{Payload: s.resolveNow(bodyNode)}
+		if s.abortErr != nil {
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+	}
+	if p.contextCallback != nil {
+		ctx := s.context(fieldStart, s.position)
+		v, err := p.contextCallback(ctx, field, lengthNode.Payload, bodyNode.Payload)
+		return s.callbackResult(v, err, ctx.Span, startPosition)
+	}
+	return Node[T]{Payload: p.callback(field, lengthNode.Payload, bodyNode.Payload)}, true
+}
+
+func (p *LengthPrefixedParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	return p.callback(d.input[:d.n], args...)
+}
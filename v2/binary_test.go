@@ -0,0 +1,92 @@
+package packrat
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestFixedIntegers(t *testing.T) {
+	input := []byte{0x34, 0x12, 0x12, 0x34, 0xfe, 0xff, 0xff, 0xff, 0x80}
+	conv := func(v uint64) int64 { return int64(v) }
+	p := NewAndParser(func(s string, a ...int64) int64 {
+		if a[0] != 0x1234 || a[1] != 0x1234 || a[2] != -2 || a[3] != -128 {
+			t.Errorf("unexpected values %v", a)
+		}
+		return 0
+	}, NewFixedUintParser(conv, 2, binary.LittleEndian), NewFixedUintParser(conv, 2, binary.BigEndian),
+		NewFixedIntParser(func(v int64) int64 { return v }, 4, binary.LittleEndian),
+		NewFixedIntParser(func(v int64) int64 { return v }, 1, binary.LittleEndian))
+	if _, err := Parse[int64](p, NewBytesScanner[int64](input)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse[int64](p, NewBytesScanner[int64](input[:7])); err == nil {
+		t.Error("truncated input should not match")
+	}
+}
+
+func TestVarint(t *testing.T) {
+	buf := binary.AppendUvarint(nil, 300)
+	buf = binary.AppendVarint(buf, -5)
+	p := NewAndParser(func(s string, a ...int64) int64 { return a[0] + a[1] },
+		NewUvarintParser(func(v uint64) int64 { return int64(v) }),
+		NewVarintParser(func(v int64) int64 { return v }))
+	n, err := Parse[int64](p, NewBytesScanner[int64](buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != 295 {
+		t.Errorf("unexpected payload %d", n.Payload)
+	}
+	if _, err := Parse[int64](p, NewBytesScanner[int64]([]byte{0x80})); err == nil {
+		t.Error("truncated varint should not match")
+	}
+}
+
+type chunk struct {
+	kind string
+	size int
+	data string
+}
+
+func TestLengthPrefixed(t *testing.T) {
+	// a tiny container format: magic, then chunks of a 4 byte tag, a
+	// big-endian length and the data, where DATA chunks hold a list of
+	// 16 bit values
+	value := func(v uint64) chunk { return chunk{size: int(v)} }
+	raw := NewLengthPrefixedParser(func(s string, a ...chunk) chunk {
+		return chunk{kind: "raw", data: s}
+	}, NewFixedUintParser(value, 4, binary.BigEndian), func(c chunk) int { return c.size }, nil)
+	words := NewKleeneParser(func(s string, a ...chunk) chunk {
+		return chunk{kind: "words", size: len(a)}
+	}, NewFixedUintParser(value, 2, binary.BigEndian), nil)
+	data := NewLengthPrefixedParser(func(s string, a ...chunk) chunk {
+		return a[1]
+	}, NewFixedUintParser(value, 4, binary.BigEndian), func(c chunk) int { return c.size }, words)
+	chunkParser := NewOrParser[chunk](
+		NewAndParser(func(s string, a ...chunk) chunk { return a[1] }, NewMagicParser(chunk{}, []byte("DATA")), data),
+		NewAndParser(func(s string, a ...chunk) chunk { return a[1] }, NewMagicParser(chunk{}, []byte("TEXT")), raw),
+	)
+	var chunks []chunk
+	file := NewAndParser(func(s string, a ...chunk) chunk {
+		chunks = append([]chunk(nil), a[1:]...)
+		return chunk{}
+	}, NewMagicParser(chunk{}, []byte{0x89, 'P', 'K'}), chunkParser, chunkParser)
+
+	input := []byte{0x89, 'P', 'K', 'T', 'E', 'X', 'T', 0, 0, 0, 2, 'h', 'i', 'D', 'A', 'T', 'A', 0, 0, 0, 4, 0, 1, 0, 2}
+	if _, err := Parse[chunk](file, NewBytesScanner[chunk](input)); err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || chunks[0].data != "hi" || chunks[1].size != 2 {
+		t.Errorf("unexpected chunks %v", chunks)
+	}
+
+	// odd length: the words do not fill the chunk
+	input[20] = 3
+	_, err := Parse[chunk](file, NewBytesScanner[chunk](input))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if err.Position != 23 {
+		t.Errorf("error should point into the chunk, got %d", err.Position)
+	}
+}
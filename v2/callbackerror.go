@@ -0,0 +1,53 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"errors"
+)
+
+// ErrMismatch marks callback errors that let the parser fail like a normal
+// mismatch, so that alternatives are tried. Wrap it to keep a message:
+//
+//	return 0, fmt.Errorf("%w: not a keyword", packrat.ErrMismatch)
+//
+// All other errors returned by callbacks installed with SetContextCallback
+// abort the parse; Parse and ParsePartial then return a ParserError with the
+// error and the span of the failing rule.
+var ErrMismatch = errors.New("packrat: mismatch")
+
+// callbackResult turns the result of a context callback for the match of
+// span into a match result. startPosition is restored on failure.
+func (s *Scanner[T]) callbackResult(v T, err error, span Span, startPosition int) (Node[T], bool) {
+	if err == nil {
+		return Node[T]{Payload: v}, true
+	}
+	if !errors.Is(err, ErrMismatch) {
+		s.abort(err, span)
+	}
+	s.setPosition(startPosition)
+	return Node[T]{}, false
+}
+
+// abort stops the parse: no rule matches anymore on this scanner and the
+// scanners it is embedded in.
+func (s *Scanner[T]) abort(err error, span Span) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if sc.abortErr == nil {
+			sc.abortErr = err
+			sc.abortSpan = span
+		}
+	}
+}
+
+// abortError builds the error returned by Parse for an aborted parse.
+func (s *Scanner[T]) abortError(p Parser[T]) *ParserError[T] {
+	input := s.abortSpan.source
+	line, column := s.abortSpan.LineColumn()
+	return &ParserError[T]{Parser: p, Line: line, Column: column, Position: s.abortSpan.Start, Input: input, Err: s.abortErr, Span: s.abortSpan}
+}
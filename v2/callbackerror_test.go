@@ -0,0 +1,113 @@
+package packrat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestErrorCallbackAbort(t *testing.T) {
+	num := NewRegexParser(func(s string) int64 { return 0 }, `[0-9]+`, false, true)
+	num.SetContextCallback(func(ctx Context[int64], s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+	list := NewManyParser(func(s string, a ...int64) int64 { return 0 }, num, NewAtomParser[int64](0, ",", false, true))
+	list.SetContextCallback(func(ctx Context[int64], s string, a ...int64) (int64, error) {
+		sum := int64(0)
+		for _, v := range a {
+			sum += v
+		}
+		return sum, nil
+	})
+
+	s := NewScanner[int64]("1, 2,\n 99999999999999999999, 3", SkipWhitespaceRegex)
+	_, err := Parse[int64](list, s)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+	if err.Line != 2 || err.Column != 2 || err.Position != 7 || err.Span.Text() != "99999999999999999999" {
+		t.Errorf("unexpected location %d:%d@%d %q", err.Line, err.Column, err.Position, err.Span.Text())
+	}
+	if !strings.Contains(err.Error(), "line 2, column 2") || !strings.Contains(err.Error(), "value out of range") {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	// the scanner can be reused
+	s.Reset("1, 2, 3", SkipWhitespaceRegex)
+	n, err := Parse[int64](list, s)
+	if err != nil || n.Payload != 6 {
+		t.Errorf("unexpected result %d %v", n.Payload, err)
+	}
+}
+
+func TestErrorCallbackMismatch(t *testing.T) {
+	// identifiers must not be keywords; a keyword lets the next alternative
+	// match instead
+	ident := NewRegexParser(func(s string) string { return s }, `[a-z]+`, false, true)
+	ident.SetContextCallback(func(ctx Context[string], s string) (string, error) {
+		if s == "null" {
+			return "", fmt.Errorf("%w: %s is reserved", ErrMismatch, s)
+		}
+		return "ident " + s, nil
+	})
+	null := NewAtomParser("null", "null", false, true)
+	expr := NewOrParser[string](ident, null)
+
+	for input, expected := range map[string]string{"abc": "ident abc", "null": "null"} {
+		n, err := Parse[string](expr, NewScanner[string](input, SkipWhitespaceRegex))
+		if err != nil || n.Payload != expected {
+			t.Errorf("%s: unexpected result %q %v", input, n.Payload, err)
+		}
+	}
+
+	// a rejected match is reported like a syntax error
+	_, err := Parse[string](ident, NewScanner[string]("null", SkipWhitespaceRegex))
+	if err == nil || err.Err != nil || err.Position != 0 {
+		t.Errorf("expected a syntax error, got %v", err)
+	}
+}
+
+func TestErrorCallbackDuplicate(t *testing.T) {
+	ident := NewRegexParser(func(s string) string { return s }, `[a-z]+`, false, true)
+	columns := NewKleeneParser(func(s string, a ...string) string { return s }, ident, NewAtomParser("", ",", false, true))
+	columns.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		seen := map[string]bool{}
+		for _, c := range a {
+			if seen[c] {
+				return "", fmt.Errorf("duplicate column %s", c)
+			}
+			seen[c] = true
+		}
+		return s, nil
+	})
+	create := NewAndParser(func(s string, a ...string) string { return a[1] }, NewAtomParser("", "(", false, true), columns, NewAtomParser("", ")", false, true))
+
+	_, err := Parse[string](create, NewScanner[string]("( a, b, a )", SkipWhitespaceRegex))
+	if err == nil || err.Err == nil || err.Err.Error() != "duplicate column a" {
+		t.Fatalf("expected the duplicate error, got %v", err)
+	}
+	if err.Span.Text() != "a, b, a" || err.Column != 3 {
+		t.Errorf("unexpected span %q at column %d", err.Span.Text(), err.Column)
+	}
+}
+
+func TestErrorCallbackEmbedded(t *testing.T) {
+	inner := NewCharClassParser(func(s string) string { return s }, NewCharClass().Spec("0-9", false), 1, 0, true)
+	inner.SetContextCallback(func(ctx Context[string], s string) (string, error) {
+		return "", errors.New("no numbers here")
+	})
+	embed := NewEmbedParser[string](inner, nil)
+	embed.SetRegion(NewRegexParser(func(s string) string { return s }, `'[^']*'`, false, true), UnquoteDoubled('\''))
+	p := NewOrParser[string](embed, NewRegexParser(func(s string) string { return s }, `'[0-9]+'`, false, true))
+
+	_, err := Parse[string](p, NewScanner[string]("  '42'", SkipWhitespaceRegex))
+	if err == nil || err.Err == nil || err.Position != 3 || err.Span.Text() != "42" {
+		t.Fatalf("the abort should end the whole parse, got %v", err)
+	}
+}
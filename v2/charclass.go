@@ -0,0 +1,252 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// CharClass is a set of runes like the bracket expression [A-Za-z0-9_] of a
+// regular expression. ASCII is looked up in a 256-bit table, other runes in
+// ranges and Unicode tables. A CharClass is built with the chaining methods
+// and must not be changed once it is used by a parser.
+type CharClass struct {
+	ascii   [4]uint64
+	ranges  []unicode.Range32
+	tables  []*unicode.RangeTable
+	negated bool
+}
+
+func NewCharClass() *CharClass {
+	return &CharClass{}
+}
+
+// Range adds the runes from lo to hi.
+func (c *CharClass) Range(lo, hi rune) *CharClass {
+	for ; lo <= hi && lo < utf8.RuneSelf; lo++ {
+		setBit(&c.ascii, byte(lo), false)
+	}
+	if lo <= hi {
+		c.ranges = append(c.ranges, unicode.Range32{Lo: uint32(lo), Hi: uint32(hi), Stride: 1})
+	}
+	return c
+}
+
+// Runes adds every rune of str.
+func (c *CharClass) Runes(str string) *CharClass {
+	for _, r := range str {
+		c.Range(r, r)
+	}
+	return c
+}
+
+// Table adds a Unicode category or script like unicode.L or unicode.Greek.
+func (c *CharClass) Table(table *unicode.RangeTable) *CharClass {
+	for _, r := range table.R16 {
+		if r.Lo >= utf8.RuneSelf {
+			break
+		}
+		for ch := r.Lo; ch <= r.Hi && ch < utf8.RuneSelf; ch += r.Stride {
+			setBit(&c.ascii, byte(ch), false)
+		}
+	}
+	c.tables = append(c.tables, table)
+	return c
+}
+
+// Spec adds an ASCII bracket expression without the brackets, e.g.
+// "A-Za-z0-9_". It panics if spec is not valid.
+func (c *CharClass) Spec(spec string, caseInsensitive bool) *CharClass {
+	for i := 0; i < len(spec); i++ {
+		if spec[i] >= utf8.RuneSelf {
+			panic("packrat: char class spec must be ASCII, use Range or Runes")
+		}
+	}
+	table, ok := buildBitmap(spec, caseInsensitive)
+	if !ok {
+		panic("packrat: invalid char class spec " + spec)
+	}
+	for i := range table {
+		c.ascii[i] |= table[i]
+	}
+	return c
+}
+
+// Negate inverts the class: it then matches every rune that was not added.
+func (c *CharClass) Negate() *CharClass {
+	c.negated = !c.negated
+	return c
+}
+
+// Contains reports whether r is in the class.
+func (c *CharClass) Contains(r rune) bool {
+	if r >= 0 && r < utf8.RuneSelf {
+		return bitmapMatch(&c.ascii, byte(r)) != c.negated
+	}
+	return c.containsNonASCII(r) != c.negated
+}
+
+func (c *CharClass) containsNonASCII(r rune) bool {
+	for _, rg := range c.ranges {
+		if uint32(r) >= rg.Lo && uint32(r) <= rg.Hi {
+			return true
+		}
+	}
+	for _, t := range c.tables {
+		if unicode.Is(t, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// intersects reports whether a rune from lo to hi is in the ranges and tables
+// of the class, ignoring negation.
+func (c *CharClass) intersects(lo, hi uint32) bool {
+	for _, rg := range c.ranges {
+		if rg.Lo <= hi && rg.Hi >= lo {
+			return true
+		}
+	}
+	inRange := func(rlo, rhi, stride uint32) bool {
+		if rhi < lo || rlo > hi {
+			return false
+		}
+		v := rlo
+		if v < lo {
+			v += (lo - rlo + stride - 1) / stride * stride
+		}
+		return v <= hi && v <= rhi
+	}
+	for _, t := range c.tables {
+		for _, r := range t.R16 {
+			if inRange(uint32(r.Lo), uint32(r.Hi), uint32(r.Stride)) {
+				return true
+			}
+		}
+		for _, r := range t.R32 {
+			if inRange(r.Lo, r.Hi, r.Stride) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// firstBytes sets the bytes a UTF-8 encoded rune of the class can start with.
+func (c *CharClass) firstBytes(bytes *[256]bool) {
+	for b := 0; b < utf8.RuneSelf; b++ {
+		bytes[b] = bitmapMatch(&c.ascii, byte(b)) != c.negated
+	}
+	if c.negated || c.containsNonASCII(utf8.RuneError) {
+		// invalid UTF-8 decodes to RuneError
+		for b := utf8.RuneSelf; b < 256; b++ {
+			bytes[b] = true
+		}
+		return
+	}
+	for b := 0xC2; b <= 0xF4; b++ {
+		var lo, hi uint32
+		switch {
+		case b < 0xE0:
+			lo = uint32(b&0x1F) << 6
+			hi = lo + 0x3F
+		case b < 0xF0:
+			lo = uint32(b&0x0F) << 12
+			hi = lo + 0xFFF
+			lo = max(lo, 0x800) // no overlong encodings
+		default:
+			lo = uint32(b&0x07) << 18
+			hi = min(lo+0x3FFFF, unicode.MaxRune)
+			lo = max(lo, 0x10000)
+		}
+		bytes[b] = c.intersects(lo, hi)
+	}
+}
+
+// CharClassParser matches a run of runes from a CharClass.
+type CharClassParser[T any] struct {
+	callback func(string) T
+	class    *CharClass
+	min, max int
+	skipWs   bool
+
+	contextCallback func(Context[T], string) (T, error)
+}
+
+// NewCharClassParser matches min to max runes of class; max <= 0 means no
+// upper limit. So [A-Za-z0-9_]+ is
+//
+//	NewCharClassParser(callback, NewCharClass().Spec("A-Za-z0-9_", false), 1, 0, true)
+func NewCharClassParser[T any](callback func(string) T, class *CharClass, min, max int, skipWs bool) *CharClassParser[T] {
+	return &CharClassParser[T]{callback: callback, class: class, min: min, max: max, skipWs: skipWs}
+}
+
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). It replaces the callback
+// given to the constructor.
+func (p *CharClassParser[T]) SetContextCallback(callback func(Context[T], string) (T, error)) {
+	p.contextCallback = callback
+}
+
+// Match matches as many runes of the class as possible.
+func (p *CharClassParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
+	startPosition := s.position
+	if p.skipWs {
+		s.Skip()
+		if !s.isAtBreak() {
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+	}
+
+	input := s.remainingInput
+	i, count := 0, 0
+	for i < len(input) && (p.max <= 0 || count < p.max) {
+		if b := input[i]; b < utf8.RuneSelf {
+			if bitmapMatch(&p.class.ascii, b) == p.class.negated {
+				break
+			}
+			i++
+		} else {
+			r, size := utf8.DecodeRuneInString(input[i:])
+			if p.class.containsNonASCII(r) == p.class.negated {
+				break
+			}
+			i += size
+		}
+		count++
+	}
+	if count < p.min {
+		s.setPosition(startPosition)
+		return Node[T]{}, false
+	}
+	s.move(i)
+
+	if p.skipWs && !s.isAtBreak() {
+		s.setPosition(startPosition)
+		return Node[T]{}, false
+	}
+	if p.contextCallback != nil {
+		ctx := s.context(s.position-i, s.position)
+		v, err := p.contextCallback(ctx, input[:i])
+		return s.callbackResult(v, err, ctx.Span, startPosition)
+	}
+	if s.deferred != nil {
+		return s.deferLeaf(p, s.position-i), true
+	}
+	return Node[T]{Payload: p.callback(input[:i])}, true
+}
+
+func (p *CharClassParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	return p.callback(d.input[:d.n])
+}
@@ -0,0 +1,82 @@
+package packrat
+
+import (
+	"testing"
+	"unicode"
+)
+
+func TestCharClassParser(t *testing.T) {
+	word := NewCharClass().Spec("A-Za-z0-9_", false)
+	tests := []struct {
+		parser   *CharClassParser[string]
+		input    string
+		expected string
+		ok       bool
+	}{
+		{NewCharClassParser(func(s string) string { return s }, word, 1, 0, false), "abc_1 x", "abc_1", true},
+		{NewCharClassParser(func(s string) string { return s }, word, 1, 0, false), " x", "", false},
+		{NewCharClassParser(func(s string) string { return s }, word, 0, 0, false), "-", "", true},
+		{NewCharClassParser(func(s string) string { return s }, word, 2, 3, false), "abcd", "abc", true},
+		{NewCharClassParser(func(s string) string { return s }, word, 2, 3, false), "a", "", false},
+		{NewCharClassParser(func(s string) string { return s }, NewCharClass().Table(unicode.L), 1, 0, false), "größeΩ1", "größeΩ", true},
+		{NewCharClassParser(func(s string) string { return s }, NewCharClass().Range('α', 'ω'), 1, 0, false), "λx", "λ", true},
+		{NewCharClassParser(func(s string) string { return s }, NewCharClass().Runes("\"\\").Negate(), 1, 0, false), "a ü\\b", "a ü", true},
+		{NewCharClassParser(func(s string) string { return s }, NewCharClass().Spec("a-z", true), 1, 0, false), "aBc", "aBc", true},
+	}
+	for i, test := range tests {
+		s := NewScanner[string](test.input, nil)
+		n, ok := test.parser.Match(s)
+		if ok != test.ok || n.Payload != test.expected {
+			t.Errorf("%d: expected %q %v, got %q %v", i, test.expected, test.ok, n.Payload, ok)
+		}
+	}
+}
+
+func TestCharClassSkipWs(t *testing.T) {
+	digits := NewCharClassParser(func(s string) string { return s }, NewCharClass().Spec("0-9", false), 1, 0, true)
+	p := NewAndParser(func(s string, a ...string) string { return a[0] + a[1] }, digits, digits)
+	if n, err := Parse[string](p, NewScanner[string](" 12  34", SkipWhitespaceRegex)); err != nil || n.Payload != "1234" {
+		t.Errorf("unexpected result %q %v", n.Payload, err)
+	}
+	// 12ab is no number at a word boundary
+	if _, err := Parse[string](digits, NewScanner[string]("12ab", SkipWhitespaceRegex)); err == nil {
+		t.Error("char class with skipWs must end at a word boundary")
+	}
+}
+
+func TestCharClassFirstBytes(t *testing.T) {
+	check := func(name string, class *CharClass) {
+		var bytes [256]bool
+		class.firstBytes(&bytes)
+		for r := rune(0); r < 0x20000; r++ {
+			if class.Contains(r) && r != unicode.ReplacementChar {
+				b := []byte(string(r))[0]
+				if !bytes[b] {
+					t.Errorf("%s: first byte %x of %U is missing", name, b, r)
+					return
+				}
+			}
+		}
+	}
+	check("letters", NewCharClass().Table(unicode.L))
+	check("greek", NewCharClass().Range('α', 'ω').Runes("_"))
+	check("negated", NewCharClass().Runes("\"").Negate())
+
+	var bytes [256]bool
+	NewCharClass().Spec("a-c", false).Range('α', 'ω').firstBytes(&bytes)
+	for b := 0; b < 256; b++ {
+		expected := b == 'a' || b == 'b' || b == 'c' || b == 0xCE || b == 0xCF
+		if bytes[b] != expected {
+			t.Errorf("byte %x: expected %v", b, expected)
+		}
+	}
+
+	// dispatch through an OrParser uses the exact set
+	p := NewOrParser[string](
+		NewCharClassParser(func(s string) string { return "greek" }, NewCharClass().Range('α', 'ω'), 1, 0, true),
+		NewCharClassParser(func(s string) string { return "latin" }, NewCharClass().Spec("a-z", false), 1, 0, true),
+	)
+	if n, err := Parse[string](p, NewScanner[string]("λογος", SkipWhitespaceRegex)); err != nil || n.Payload != "greek" {
+		t.Errorf("unexpected result %q %v", n.Payload, err)
+	}
+}
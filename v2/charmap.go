@@ -7,6 +7,10 @@
 
 package packrat
 
+import (
+	"strings"
+)
+
 // parserFirstBytes returns the set of first bytes that parser p could match
 // (after whitespace has been skipped by the parent OrParser). The second return
 // value indicates whether the parser can match at end-of-input (empty match or
@@ -25,6 +29,10 @@ func parserFirstBytes[T any](p Parser[T], visited map[any]bool) (bytes [256]bool
 
 	switch pp := p.(type) {
 	case *AtomParser[T]:
+		if pp.fold != nil {
+			pp.fold.firstBytes(&bytes)
+			return bytes, len(pp.fold.folded) == 0
+		}
 		if len(pp.atom) == 0 {
 			fillAllBytes(&bytes)
 			return bytes, true
@@ -44,6 +52,27 @@ func parserFirstBytes[T any](p Parser[T], visited map[any]bool) (bytes [256]bool
 		eof := regexFirstBytes(pp.rs, pp.caseInsensitive, &bytes)
 		return bytes, eof
 
+	case *CharClassParser[T]:
+		pp.class.firstBytes(&bytes)
+		return bytes, pp.min == 0
+
+	case *TokenParser[T]:
+		// token scanners dispatch on the first byte of the token text
+		if !pp.byText || pp.text == "" || (pp.caseInsensitive && pp.text[0] >= 0x80) {
+			fillAllBytes(&bytes)
+			return bytes, false
+		}
+		b := pp.text[0]
+		bytes[b] = true
+		if pp.caseInsensitive {
+			if b >= 'a' && b <= 'z' {
+				bytes[b-32] = true
+			} else if b >= 'A' && b <= 'Z' {
+				bytes[b+32] = true
+			}
+		}
+		return bytes, false
+
 	case *AndParser[T]:
 		// Walk children: if a child can match empty, also include the
 		// next child's first bytes (because the empty-matching child
@@ -62,7 +91,17 @@ func parserFirstBytes[T any](p Parser[T], visited map[any]bool) (bytes [256]bool
 		return bytes, true
 
 	case *OrParser[T]:
-		for _, child := range pp.subParser {
+		for _, child := range pp.current.Load().subParser {
+			cb, ceof := parserFirstBytes[T](child, visited)
+			canMatchEOF = canMatchEOF || ceof
+			for i := range bytes {
+				bytes[i] = bytes[i] || cb[i]
+			}
+		}
+		return bytes, canMatchEOF
+
+	case *LongestParser[T]:
+		for _, child := range pp.current.Load().subParser {
 			cb, ceof := parserFirstBytes[T](child, visited)
 			canMatchEOF = canMatchEOF || ceof
 			for i := range bytes {
@@ -78,6 +117,9 @@ func parserFirstBytes[T any](p Parser[T], visited map[any]bool) (bytes [256]bool
 	case *NotParser[T]:
 		return parserFirstBytes[T](pp.mainParser, visited)
 
+	case *NamedParser[T]:
+		return parserFirstBytes[T](pp.subParser, visited)
+
 	case *EmptyParser[T]:
 		// Matches empty — no active first bytes, but canMatchEOF=true
 		return bytes, true
@@ -94,10 +136,29 @@ func parserFirstBytes[T any](p Parser[T], visited map[any]bool) (bytes [256]bool
 		cb, _ := parserFirstBytes[T](pp.subParser, visited)
 		return cb, true
 
+	case *EmbedParser[T]:
+		if pp.region != nil {
+			return parserFirstBytes[T](pp.region, visited)
+		}
+		if pp.skipper != nil {
+			// the embedded skipper may skip bytes the host skipper does not
+			fillAllBytes(&bytes)
+			return bytes, true
+		}
+		return parserFirstBytes[T](pp.inner, visited)
+
 	case *RestParser[T]:
 		fillAllBytes(&bytes)
 		return bytes, true
 
+	case *FixedUintParser[T], *VarintParser[T]:
+		// binary values can start with any byte but never match empty
+		fillAllBytes(&bytes)
+		return bytes, false
+
+	case *LengthPrefixedParser[T]:
+		return parserFirstBytes[T](pp.length, visited)
+
 	case *EndParser[T]:
 		// Only matches end of input, no bytes
 		return bytes, true
@@ -121,6 +182,16 @@ func regexFirstBytes(rs string, caseInsensitive bool, bytes *[256]bool) bool {
 	if len(rs) == 0 {
 		return true // empty pattern matches empty
 	}
+	alts := splitAlternatives(rs)
+	if len(alts) > 1 {
+		eof := false
+		for _, alt := range alts {
+			if regexFirstBytesAt(alt, 0, caseInsensitive, bytes) {
+				eof = true
+			}
+		}
+		return eof
+	}
 	return regexFirstBytesAt(rs, 0, caseInsensitive, bytes)
 }
 
@@ -133,8 +204,13 @@ func regexFirstBytesAt(rs string, pos int, caseInsensitive bool, bytes *[256]boo
 
 	var elemBytes [256]bool
 	nextPos := pos
+	canBeEmpty := false // the element itself may match the empty string
 
 	switch {
+	case rs[pos] == '^':
+		// anchor at the start: zero width
+		return regexFirstBytesAt(rs, pos+1, caseInsensitive, bytes)
+
 	case rs[pos] == '(':
 		// Group: find matching close paren
 		closePos := findGroupClose(rs, pos)
@@ -148,12 +224,18 @@ func regexFirstBytesAt(rs string, pos int, caseInsensitive bool, bytes *[256]boo
 		groupContent := rs[pos+1 : closePos]
 		if len(groupContent) >= 2 && groupContent[0] == '?' && groupContent[1] == ':' {
 			groupContent = groupContent[2:]
+		} else if len(groupContent) >= 1 && groupContent[0] == '?' {
+			// flag groups like (?i) change the meaning of what follows
+			fillAllBytes(bytes)
+			return true
 		}
 
 		// Split by | at depth 0 and analyze each alternative
 		alts := splitAlternatives(groupContent)
 		for _, alt := range alts {
-			regexFirstBytesAt(alt, 0, caseInsensitive, &elemBytes)
+			if regexFirstBytesAt(alt, 0, caseInsensitive, &elemBytes) {
+				canBeEmpty = true
+			}
 		}
 
 	case rs[pos] == '[':
@@ -195,6 +277,32 @@ func regexFirstBytesAt(rs string, pos int, caseInsensitive bool, bytes *[256]boo
 	case rs[pos] == '\\':
 		if pos+1 < len(rs) {
 			ch := rs[pos+1]
+			switch ch {
+			case 'd':
+				for c := '0'; c <= '9'; c++ {
+					elemBytes[c] = true
+				}
+				nextPos = pos + 2
+			case 's':
+				for _, c := range "\t\n\f\r " {
+					elemBytes[c] = true
+				}
+				nextPos = pos + 2
+			case 'w':
+				for c := 0; c < 256; c++ {
+					elemBytes[c] = c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+				}
+				nextPos = pos + 2
+			}
+			if nextPos != pos {
+				break
+			}
+			if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') {
+				// other classes (\D, \pL), assertions (\b, \z) and
+				// hex or octal escapes: give up precisely
+				fillAllBytes(bytes)
+				return true
+			}
 			elemBytes[ch] = true
 			if caseInsensitive {
 				if ch >= 'a' && ch <= 'z' {
@@ -223,14 +331,29 @@ func regexFirstBytesAt(rs string, pos int, caseInsensitive bool, bytes *[256]boo
 	}
 
 	// Check quantifier
-	optional := false
+	optional := canBeEmpty
 	if nextPos < len(rs) {
+		quantified := true
 		switch rs[nextPos] {
 		case '?', '*':
 			optional = true
 			nextPos++
 		case '+':
 			nextPos++
+		case '{':
+			closeBrace := strings.IndexByte(rs[nextPos:], '}')
+			if closeBrace < 0 {
+				fillAllBytes(bytes)
+				return true
+			}
+			optional = rs[nextPos+1] == '0' || rs[nextPos+1] == ','
+			nextPos += closeBrace + 1
+		default:
+			quantified = false
+		}
+		// lazy and possessive modifiers
+		if quantified && nextPos < len(rs) && (rs[nextPos] == '?' || rs[nextPos] == '+') {
+			nextPos++
 		}
 	}
 
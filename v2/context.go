@@ -0,0 +1,27 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+// Context describes a match to callbacks installed with SetContextCallback.
+// Such callbacks get the same arguments as the callback of the constructor
+// after the context and can fail: an error wrapping ErrMismatch makes the
+// parser fail like a normal mismatch, other errors abort the parse. They run
+// while matching also in deferred mode (see SetDeferred).
+type Context[T any] struct {
+	// Span is the part of the source the parser matched, without leading
+	// whitespace.
+	Span Span
+	// Scanner is the scanner of the parse, e.g. to reach per-parse state in
+	// Scanner.UserData.
+	Scanner *Scanner[T]
+}
+
+// context returns the context of a match from start to end.
+func (s *Scanner[T]) context(start, end int) Context[T] {
+	return Context[T]{Span: s.span(start, end), Scanner: s}
+}
@@ -0,0 +1,164 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+// In deferred mode (see SetDeferred), parsers with callbacks return a node
+// that refers to a derivation instead of a payload. The derivation records
+// what the callback needs: the matched text, its position and the child
+// nodes. Derivations of matches that are thrown away later are never
+// built. Nodes without a derivation, e.g. of atoms or custom parsers, keep
+// their payload.
+
+// derivation is a deferred match of parser.
+type derivation[T any] struct {
+	parser       deferredBuilder[T]
+	input        string // input from the start of the match
+	n            int    // length of the match in input
+	pos          int    // scanner position of the start
+	first, count int32  // child nodes in deferredStore.children
+}
+
+// deferredBuilder is implemented by parsers that defer their callback.
+type deferredBuilder[T any] interface {
+	build(s *Scanner[T], d *derivation[T], args []T) T
+}
+
+// deferredStore holds the derivations of a scanner and its embedded scanners.
+type deferredStore[T any] struct {
+	derivs   []derivation[T]
+	children []Node[T]
+	stack    []Node[T] // children of the matches in progress
+	values   []T       // arguments of the callbacks in progress
+	// payloads of derivations that were needed while matching, so that
+	// their callbacks do not run again
+	resolved map[int32]T
+}
+
+func (st *deferredStore[T]) reset() {
+	clear(st.children)
+	clear(st.stack)
+	st.derivs = st.derivs[:0]
+	st.children = st.children[:0]
+	st.stack = st.stack[:0]
+	clear(st.resolved)
+}
+
+// SetDeferred switches the scanner to two-phase parsing. While matching,
+// parsers only record what matched and run no callbacks. When the parse has
+// succeeded, Parse and ParsePartial run the callbacks of the winning
+// derivation exactly once, bottom-up, so callbacks of matches discarded by
+// backtracking or left recursion never run. Payloads and errors are the same
+// as without deferring.
+//
+// Context callbacks (see Context) are the exception: since they can fail,
+// they run while matching like without deferring, so that an ErrMismatch
+// backtracks. A combinator with a context callback, and the length parser of
+// a LengthPrefixedParser, runs the callbacks of its sub matches right away;
+// each of them still runs once.
+//
+// Custom parsers that combine payloads of sub parsers do not work in this
+// mode; custom parsers that do not call sub parsers do. Reset does not change
+// this setting.
+func (s *Scanner[T]) SetDeferred(deferred bool) {
+	if !deferred {
+		s.deferred = nil
+	} else if s.deferred == nil {
+		s.deferred = &deferredStore[T]{}
+	}
+}
+
+// deferMark returns the mark to pass to deferMatch for the children pushed
+// from now on.
+func (s *Scanner[T]) deferMark() int {
+	if s.deferred == nil {
+		return 0
+	}
+	return len(s.deferred.stack)
+}
+
+// deferChild pushes a child of the match in progress.
+func (s *Scanner[T]) deferChild(n Node[T]) {
+	s.deferred.stack = append(s.deferred.stack, n)
+}
+
+// deferDrop discards the children pushed since mark.
+func (s *Scanner[T]) deferDrop(mark int) {
+	if s.deferred != nil {
+		clear(s.deferred.stack[mark:])
+		s.deferred.stack = s.deferred.stack[:mark]
+	}
+}
+
+// deferMatch records a match of p with the children pushed since mark.
+func (s *Scanner[T]) deferMatch(p deferredBuilder[T], input string, n, pos int, mark int) Node[T] {
+	st := s.deferred
+	first := len(st.children)
+	st.children = append(st.children, st.stack[mark:]...)
+	clear(st.stack[mark:])
+	st.stack = st.stack[:mark]
+	st.derivs = append(st.derivs, derivation[T]{parser: p, input: input, n: n, pos: pos, first: int32(first), count: int32(len(st.children) - first)})
+	return Node[T]{deriv: int32(len(st.derivs))}
+}
+
+// deferLeaf records a match of p from start to the current position.
+func (s *Scanner[T]) deferLeaf(p deferredBuilder[T], start int) Node[T] {
+	return s.deferMatch(p, s.input[start:], s.position-start, start, len(s.deferred.stack))
+}
+
+// resolveChildren runs the deferred callbacks of the children pushed since
+// mark while matching, for context callbacks of combinators (see
+// SetDeferred). It appends the payloads to s.args and reports false if a
+// callback aborted the parse.
+func (s *Scanner[T]) resolveChildren(mark int) bool {
+	for _, c := range s.deferred.stack[mark:] {
+		s.args = append(s.args, s.resolveNow(c))
+	}
+	s.deferDrop(mark)
+	return s.abortErr == nil
+}
+
+// resolveNow resolves n while matching. The payload is kept, so that the
+// callbacks of n run once also if n is needed again, e.g. by another rule
+// that uses the same memoized match.
+func (s *Scanner[T]) resolveNow(n Node[T]) T {
+	if n.deriv == 0 {
+		return n.Payload
+	}
+	v := s.resolve(n)
+	st := s.deferred
+	if st.resolved == nil {
+		st.resolved = make(map[int32]T)
+	}
+	st.resolved[n.deriv] = v
+	return v
+}
+
+// resolve runs the deferred callbacks of n bottom-up and returns its payload.
+func (s *Scanner[T]) resolve(n Node[T]) T {
+	if n.deriv == 0 || s.abortErr != nil {
+		return n.Payload
+	}
+	st := s.deferred
+	if v, ok := st.resolved[n.deriv]; ok {
+		return v
+	}
+	d := &st.derivs[n.deriv-1]
+	mark := len(st.values)
+	for _, c := range st.children[d.first : d.first+d.count] {
+		v := s.resolve(c)
+		st.values = append(st.values, v)
+	}
+	v := d.parser.build(s, d, st.values[mark:])
+	clear(st.values[mark:])
+	st.values = st.values[:mark]
+	if s.abortErr != nil {
+		var zero T
+		return zero
+	}
+	return v
+}
@@ -0,0 +1,212 @@
+package packrat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDeferredLeftRecursion(t *testing.T) {
+	calls := 0
+	num := NewRegexParser(func(s string) string { return s }, `[0-9]+`, false, true)
+	expr := NewOrParser[string]()
+	plus := NewAndParser(func(s string, a ...string) string {
+		calls++
+		return "(" + a[0] + "+" + a[2] + ")"
+	}, expr, NewAtomParser("", "+", false, true), num)
+	expr.Set(plus, num)
+
+	s := NewScanner[string]("1 + 2 + 3 + 4", SkipWhitespaceRegex)
+	n, err := Parse[string](expr, s)
+	if err != nil || n.Payload != "(((1+2)+3)+4)" {
+		t.Fatalf("unexpected result %q %v", n.Payload, err)
+	}
+	eager := calls
+
+	calls = 0
+	s.Reset("1 + 2 + 3 + 4", SkipWhitespaceRegex)
+	s.SetDeferred(true)
+	n, err = Parse[string](expr, s)
+	if err != nil || n.Payload != "(((1+2)+3)+4)" {
+		t.Fatalf("unexpected deferred result %q %v", n.Payload, err)
+	}
+	if calls != 3 {
+		t.Errorf("deferred callbacks should run once per node: %d calls (%d eager)", calls, eager)
+	}
+}
+
+func TestDeferredBacktracking(t *testing.T) {
+	calls := 0
+	word := NewRegexParser(func(s string) string { return s }, `[a-z]+`, false, true)
+	list := NewKleeneParser(func(s string, a ...string) string {
+		calls++
+		return strings.Join(a, ",")
+	}, word, nil)
+	words := NewManyParser(func(s string, a ...string) string { return strings.Join(a, " ") }, word, nil)
+	p := NewOrParser[string](NewAndParser(func(s string, a ...string) string { return a[0] }, list, NewAtomParser("", "!", false, true)), words)
+
+	for _, deferred := range []bool{false, true} {
+		calls = 0
+		s := NewScanner[string]("a b c", SkipWhitespaceRegex)
+		s.SetDeferred(deferred)
+		n, err := Parse[string](p, s)
+		if err != nil || n.Payload != "a b c" {
+			t.Fatalf("unexpected result %q %v", n.Payload, err)
+		}
+		if deferred && calls != 0 {
+			t.Errorf("callbacks of discarded matches should not run, got %d calls", calls)
+		}
+		if !deferred && calls != 1 {
+			t.Errorf("expected one eager call, got %d", calls)
+		}
+	}
+}
+
+// parseBoth parses input eagerly and deferred and checks that the payloads
+// agree.
+func parseBoth(t *testing.T, p Parser[string], newScanner func() *Scanner[string]) {
+	t.Helper()
+	eager, err := Parse[string](p, newScanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newScanner()
+	s.SetDeferred(true)
+	deferred, err := Parse[string](p, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eager.Payload != deferred.Payload {
+		t.Errorf("payloads differ\n%s\n%s", eager.Payload, deferred.Payload)
+	}
+}
+
+func TestDeferredPayloads(t *testing.T) {
+	join := func(s string, a ...string) string { return "[" + strings.Join(a, " ") + "]" }
+
+	// spans, captures, char classes, context callbacks and embedding
+	ident := NewCharClassParser(func(s string) string { return s }, NewCharClass().Spec("a-z", false), 1, 0, true)
+	ident.SetContextCallback(func(ctx Context[string], s string) (string, error) {
+		return fmt.Sprintf("%s@%d", s, ctx.Span.Start), nil
+	})
+	pair := NewRegexCaptureParser(func(groups []string, offsets []int) string {
+		return fmt.Sprint(groups, offsets)
+	}, `([0-9]+)(?:\.([0-9]+))?`, false, true)
+	inner := NewRegexParser(func(s string) string { return s }, `[0-9]+`, false, true)
+	inner.SetContextCallback(func(ctx Context[string], match string) (string, error) { return "embedded " + match, nil })
+	embed := NewEmbedParser[string](inner, nil)
+	embed.SetRegion(NewRegexParser(func(s string) string { return s }, `'[^']*'`, false, true), UnquoteDoubled('\''))
+	empty := NewKleeneParser(join, NewAtomParser("", "?", false, true), nil)
+	item := NewOrParser[string](ident, embed, pair)
+	list := NewAndParser(join, NewManyParser(join, item, NewAtomParser("", ",", false, true)), empty, NewMaybeParser("none", NewAtomParser("x", ";", false, true)))
+	list.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		return fmt.Sprintf("%d-%d %v", ctx.Span.Start, ctx.Span.End, a), nil
+	})
+	parseBoth(t, list, func() *Scanner[string] {
+		return NewScanner[string](" ab, 1.5, '7', 3, cd", SkipWhitespaceRegex)
+	})
+
+	// tokens
+	source := "SELECT a, b FROM t"
+	tokens, err := sqlLexer().Tokenize(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := NewTokenKindParser(func(tok Token) string { return fmt.Sprintf("%s@%d", tok.Text, tok.Pos) }, "ident")
+	query := NewAndParser(join, NewTokenTextParser("SELECT", "SELECT", true), NewManyParser(join, name, NewTokenTextParser("", ",", false)), NewTokenTextParser("", "FROM", true), name)
+	parseBoth(t, query, func() *Scanner[string] { return NewTokenScanner[string](source, tokens) })
+
+	// binary
+	u16 := NewFixedUintParser(func(v uint64) string { return fmt.Sprint(v) }, 2, binary.BigEndian)
+	chunk := NewLengthPrefixedParser(join, NewUvarintParser(func(v uint64) string { return fmt.Sprint(v) }), func(v string) int {
+		var n int
+		fmt.Sscan(v, &n)
+		return n
+	}, NewKleeneParser(join, u16, nil))
+	file := NewAndParser(join, NewMagicParser("", []byte("PK")), chunk, chunk)
+	data := []byte{'P', 'K', 4, 0, 1, 0, 2, 2, 1, 0}
+	parseBoth(t, file, func() *Scanner[string] { return NewBytesScanner[string](data) })
+}
+
+func TestDeferredErrorCallback(t *testing.T) {
+	num := NewRegexParser(func(s string) string { return s }, `[0-9]+`, false, true)
+	num.SetContextCallback(func(ctx Context[string], s string) (string, error) {
+		if len(s) > 3 {
+			return "", fmt.Errorf("%s is too long", s)
+		}
+		return s, nil
+	})
+	list := NewKleeneParser(func(s string, a ...string) string { return strings.Join(a, ",") }, num, NewAtomParser("", ",", false, true))
+	s := NewScanner[string]("1, 12345", SkipWhitespaceRegex)
+	s.SetDeferred(true)
+	_, err := Parse[string](list, s)
+	if err == nil || err.Err == nil || err.Span.Text() != "12345" {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+
+	s.Reset("1, 23", SkipWhitespaceRegex)
+	n, err := Parse[string](list, s)
+	if err != nil || n.Payload != "1,23" {
+		t.Errorf("unexpected result %q %v", n.Payload, err)
+	}
+}
+
+func TestDeferredMismatch(t *testing.T) {
+	// context callbacks fail the same way with and without deferring
+	ident := NewRegexParser(func(s string) string { return s }, `[a-z]+`, false, true)
+	ident.SetContextCallback(func(ctx Context[string], s string) (string, error) {
+		if s == "null" {
+			return "", fmt.Errorf("%w: %s is a keyword", ErrMismatch, s)
+		}
+		return "ident " + s, nil
+	})
+	value := NewOrParser[string](ident, NewAtomParser("NULL", "null", false, true))
+	join := func(s string, a ...string) string { return "[" + strings.Join(a, " ") + "]" }
+	pair := NewAndParser(join, value, value)
+	pair.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		if a[0] == a[1] {
+			return "", fmt.Errorf("%w: duplicate", ErrMismatch)
+		}
+		if a[1] == "ident stop" {
+			return "", errors.New("stop")
+		}
+		return "pair" + join(s, a...), nil
+	})
+	items := NewKleeneParser(join, NewOrParser[string](pair, value), NewAtomParser("", ",", false, true))
+	items.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		if len(a) > 3 {
+			return "", fmt.Errorf("%w: too many", ErrMismatch)
+		}
+		return fmt.Sprintf("%d-%d%s", ctx.Span.Start, ctx.Span.End, join(s, a...)), nil
+	})
+	list := NewOrParser[string](NewAndParser(join, items, NewEndParser("", true)), NewManyParser(join, NewAtomParser("x", "a", false, true), nil))
+
+	for _, input := range []string{"a b, null, c", "x x, null null, y", "a, b, c, d", "a a a a", "a stop", "a,,"} {
+		eager, eagerErr := Parse[string](list, NewScanner[string](input, SkipWhitespaceRegex))
+		s := NewScanner[string](input, SkipWhitespaceRegex)
+		s.SetDeferred(true)
+		deferred, deferredErr := Parse[string](list, s)
+		if eager.Payload != deferred.Payload || fmt.Sprint(eagerErr) != fmt.Sprint(deferredErr) {
+			t.Errorf("%q: results differ\n%q %v\n%q %v", input, eager.Payload, eagerErr, deferred.Payload, deferredErr)
+		}
+	}
+
+	// the length of a length prefixed field is resolved once
+	calls := 0
+	length := NewUvarintParser(func(v uint64) int { calls++; return int(v) })
+	field := NewLengthPrefixedParser(func(s string, a ...int) int { return len(s) }, length, func(v int) int { return v }, nil)
+	field.SetContextCallback(func(ctx Context[int], s string, a ...int) (int, error) {
+		if s == "no" {
+			return 0, ErrMismatch
+		}
+		return a[0], nil
+	})
+	other := NewLengthPrefixedParser(func(s string, a ...int) int { return -a[0] }, length, func(v int) int { return v }, nil)
+	s := NewBytesScanner[int]([]byte{2, 'n', 'o'})
+	s.SetDeferred(true)
+	if n, err := Parse[int](NewOrParser[int](field, other), s); err != nil || n.Payload != -2 || calls != 1 {
+		t.Errorf("unexpected result %d %v after %d length callbacks", n.Payload, err, calls)
+	}
+}
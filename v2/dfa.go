@@ -0,0 +1,360 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"regexp/syntax"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The DFA fast path compiles a regex with regexp/syntax and runs a subset
+// construction over its program. The alphabet consists of the 128 ASCII
+// bytes, a few non-ASCII runes the regex treats specially (like the Kelvin
+// sign that (?i)k matches) and one symbol for all other runes. So it handles
+// alternations of literals, optional groups, bounded repetitions and classes
+// like [^"] or ., but not Unicode categories. Threads are kept in priority
+// order and cut after a match, which gives the leftmost-first semantics of
+// package regexp.
+
+const (
+	dfaMaxSpecial = 32
+	dfaMaxSymbols = utf8.RuneSelf + dfaMaxSpecial + 1
+	dfaMaxStates  = 256
+	dfaMaxThreads = 1024
+	dfaMaxGap     = 8 // ranges and gaps up to this size become special runes
+)
+
+type dfaState struct {
+	next  [dfaMaxSymbols]int16 // -1: no transition
+	match bool
+}
+
+type dfaBuilder struct {
+	prog     *syntax.Prog
+	nonASCII [][]rune // per instruction: sorted non-ASCII ranges it matches
+	special  []rune
+	symbols  int                   // ASCII, special runes, other runes
+	accepts  [][dfaMaxSymbols]bool // per instruction, for rune instructions
+	states   []dfaState
+	threads  [][]uint32 // thread list of each state, Match is always last
+	index    map[string]int
+	visited  []bool
+}
+
+// compileDFA returns a matcher for rs anchored at the start of the input, or
+// nil if rs uses constructs the DFA does not support.
+func compileDFA(rs string, caseInsensitive bool) func(string) int {
+	flags := syntax.Perl
+	if caseInsensitive {
+		flags |= syntax.FoldCase
+	}
+	re, err := syntax.Parse(rs, flags)
+	if err != nil {
+		return nil
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil
+	}
+
+	b := &dfaBuilder{prog: prog, nonASCII: make([][]rune, len(prog.Inst)), accepts: make([][dfaMaxSymbols]bool, len(prog.Inst)), index: make(map[string]int), visited: make([]bool, len(prog.Inst))}
+	for pc := range prog.Inst {
+		if !b.supported(pc) {
+			return nil
+		}
+	}
+	if !b.collectSpecial() {
+		return nil
+	}
+	for pc := range prog.Inst {
+		if !b.prepare(pc) {
+			return nil
+		}
+	}
+
+	start, ok := b.closure([]uint32{uint32(prog.Start)}, true)
+	if !ok {
+		return nil
+	}
+	b.state(start)
+	for i := 0; i < len(b.states); i++ {
+		for sym := 0; sym < b.symbols; sym++ {
+			var next []uint32
+			for _, pc := range b.threads[i] {
+				inst := &prog.Inst[pc]
+				if inst.Op != syntax.InstMatch && b.accepts[pc][sym] {
+					next = append(next, inst.Out)
+				}
+			}
+			list, ok := b.closure(next, false)
+			if !ok {
+				return nil
+			}
+			if len(list) == 0 {
+				b.states[i].next[sym] = -1
+				continue
+			}
+			n := b.state(list)
+			if n < 0 {
+				return nil
+			}
+			b.states[i].next[sym] = int16(n)
+		}
+	}
+
+	states := b.states
+	special := b.special
+	other := b.symbols - 1
+	return func(input string) int {
+		st := &states[0]
+		last := -1
+		if st.match {
+			last = 0
+		}
+		for i := 0; i < len(input); {
+			sym, size := int(input[i]), 1
+			if sym >= utf8.RuneSelf {
+				var r rune
+				r, size = utf8.DecodeRuneInString(input[i:])
+				sym = other
+				for j, sp := range special {
+					if sp == r {
+						sym = utf8.RuneSelf + j
+						break
+					}
+				}
+			}
+			n := st.next[sym]
+			if n < 0 {
+				break
+			}
+			st = &states[n]
+			i += size
+			if st.match {
+				last = i
+			}
+		}
+		return last
+	}
+}
+
+// supported checks that instruction pc is supported and collects the
+// non-ASCII runes of rune instructions.
+func (b *dfaBuilder) supported(pc int) bool {
+	inst := &b.prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstAlt, syntax.InstAltMatch, syntax.InstCapture, syntax.InstNop, syntax.InstMatch, syntax.InstFail:
+		return true
+	case syntax.InstEmptyWidth:
+		// only the anchor at the start of the match is supported
+		return syntax.EmptyOp(inst.Arg)&^syntax.EmptyBeginText == 0
+	case syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+		b.nonASCII[pc] = []rune{utf8.RuneSelf, unicode.MaxRune}
+		return true
+	case syntax.InstRune, syntax.InstRune1:
+		if len(inst.Rune) == 1 {
+			// a single rune, MatchRune also matches its case variants
+			// if FoldCase is set
+			var ranges []rune
+			r := inst.Rune[0]
+			add := func(f rune) {
+				if f >= utf8.RuneSelf {
+					ranges = append(ranges, f, f)
+				}
+			}
+			add(r)
+			if syntax.Flags(inst.Arg)&syntax.FoldCase != 0 {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					add(f)
+				}
+			}
+			b.nonASCII[pc] = ranges
+			return true
+		}
+		var ranges []rune
+		for i := 0; i+1 < len(inst.Rune); i += 2 {
+			lo, hi := inst.Rune[i], inst.Rune[i+1]
+			if hi >= utf8.RuneSelf {
+				ranges = append(ranges, max(lo, utf8.RuneSelf), hi)
+			}
+		}
+		b.nonASCII[pc] = ranges
+		return true
+	}
+	return false
+}
+
+// collectSpecial picks the non-ASCII runes that get symbols of their own:
+// small ranges and small gaps between ranges. All other non-ASCII runes must
+// then be matched by an instruction either all or not at all.
+func (b *dfaBuilder) collectSpecial() bool {
+	seen := make(map[rune]bool)
+	add := func(lo, hi rune) {
+		if hi-lo >= dfaMaxGap {
+			return
+		}
+		for r := lo; r <= hi; r++ {
+			if !seen[r] {
+				seen[r] = true
+				b.special = append(b.special, r)
+			}
+		}
+	}
+	for _, ranges := range b.nonASCII {
+		sortRanges(ranges)
+		next := rune(utf8.RuneSelf)
+		for i := 0; i+1 < len(ranges); i += 2 {
+			lo, hi := ranges[i], ranges[i+1]
+			if lo > next {
+				add(next, lo-1)
+			}
+			add(lo, hi)
+			next = max(next, hi+1)
+		}
+		if len(ranges) > 0 && next <= unicode.MaxRune {
+			add(next, unicode.MaxRune)
+		}
+	}
+	b.symbols = utf8.RuneSelf + len(b.special) + 1
+	return len(b.special) <= dfaMaxSpecial
+}
+
+// prepare computes the accepted symbols of instruction pc.
+func (b *dfaBuilder) prepare(pc int) bool {
+	inst := &b.prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstRuneAny, syntax.InstRuneAnyNotNL, syntax.InstRune, syntax.InstRune1:
+	default:
+		return true
+	}
+	ranges := b.nonASCII[pc]
+	contains := func(r rune) bool {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if r >= ranges[i] && r <= ranges[i+1] {
+				return true
+			}
+		}
+		return false
+	}
+	for r := 0; r < utf8.RuneSelf; r++ {
+		b.accepts[pc][r] = inst.MatchRune(rune(r))
+	}
+	for j, r := range b.special {
+		b.accepts[pc][utf8.RuneSelf+j] = contains(r)
+	}
+
+	// other runes: either all of them (no gap apart from special runes) or
+	// none (only special runes)
+	isSpecial := func(r rune) bool {
+		for _, sp := range b.special {
+			if sp == r {
+				return true
+			}
+		}
+		return false
+	}
+	none := true
+	next := rune(utf8.RuneSelf)
+	gap := false
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		for r := next; r < lo; r++ {
+			if !isSpecial(r) {
+				gap = true
+				break
+			}
+		}
+		for r := lo; r <= hi && none; r++ {
+			if !isSpecial(r) {
+				none = false
+			}
+		}
+		next = max(next, hi+1)
+	}
+	for r := next; r <= unicode.MaxRune && !gap; r++ {
+		if !isSpecial(r) {
+			gap = true
+		}
+	}
+	if !none && gap {
+		return false
+	}
+	b.accepts[pc][b.symbols-1] = !none
+	return true
+}
+
+func sortRanges(ranges []rune) {
+	// insertion sort on pairs, the lists are short
+	for i := 2; i+1 < len(ranges); i += 2 {
+		for j := i; j >= 2 && ranges[j] < ranges[j-2]; j -= 2 {
+			ranges[j], ranges[j-2] = ranges[j-2], ranges[j]
+			ranges[j+1], ranges[j-1] = ranges[j-1], ranges[j+1]
+		}
+	}
+}
+
+// closure follows the empty transitions from pcs in priority order. It
+// returns the rune instructions reached, followed by Match if a match is
+// reached; lower priority threads after a match are cut.
+func (b *dfaBuilder) closure(pcs []uint32, atStart bool) ([]uint32, bool) {
+	clear(b.visited)
+	var list []uint32
+	matched := false
+	var add func(pc uint32)
+	add = func(pc uint32) {
+		if matched || b.visited[pc] {
+			return
+		}
+		b.visited[pc] = true
+		inst := &b.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			add(inst.Out)
+			add(inst.Arg)
+		case syntax.InstCapture, syntax.InstNop:
+			add(inst.Out)
+		case syntax.InstEmptyWidth:
+			if atStart {
+				add(inst.Out)
+			}
+		case syntax.InstMatch:
+			list = append(list, pc)
+			matched = true
+		case syntax.InstFail:
+		default:
+			list = append(list, pc)
+		}
+	}
+	for _, pc := range pcs {
+		add(pc)
+	}
+	return list, len(list) <= dfaMaxThreads
+}
+
+// state returns the index of the state for the thread list, creating it if
+// necessary, or -1 if there are too many states.
+func (b *dfaBuilder) state(list []uint32) int {
+	key := make([]byte, 0, 4*len(list))
+	for _, pc := range list {
+		key = append(key, byte(pc), byte(pc>>8), byte(pc>>16), byte(pc>>24))
+	}
+	if i, ok := b.index[string(key)]; ok {
+		return i
+	}
+	if len(b.states) >= dfaMaxStates {
+		return -1
+	}
+	i := len(b.states)
+	b.index[string(key)] = i
+	st := dfaState{}
+	st.match = len(list) > 0 && b.prog.Inst[list[len(list)-1]].Op == syntax.InstMatch
+	b.states = append(b.states, st)
+	b.threads = append(b.threads, list)
+	return i
+}
@@ -0,0 +1,108 @@
+package packrat
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDFAMatchesRegexp(t *testing.T) {
+	patterns := []string{
+		`(true|false)`,
+		`true|false|null`,
+		`a|ab`,
+		`ab|a`,
+		`(a|ab)(c|bcd)`,
+		`colou?r`,
+		`[0-9]{2,4}`,
+		`x{3}`,
+		`(?:ab)*c?`,
+		`a*?b`,
+		`a+?`,
+		`[^"]*"`,
+		`.+`,
+		`(?s).+`,
+		`-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?`,
+		`[0-9]{4}-[0-9]{2}-[0-9]{2}(T[0-9]{2}:[0-9]{2})?`,
+		`SELECT|SET|SEL`,
+		`\d+\s*\w`,
+		`^abc`,
+		``,
+		`(a|b)*abb`,
+		`[äöü]+`,
+		`straße|sk`,
+		`[^k]+`,
+	}
+	inputs := []string{
+		"", "true", "false", "truex", "null", "ab", "abc", "abcd", "abbcd", "color", "colour", "colouur",
+		"1", "12", "123", "12345", "xxx", "xx", "ababc", "abab", "aab", "aaa", `hello"`, `über"x`,
+		"line\nnext", "-12.5e+3", "0.5", "01", "2026-10-19T12:30", "2026-10-19", "select", "SET x", "SELF",
+		"42 \t x", "42", "babb", "aabbabb", "\xff\xfeabc", "ü", "äöüx", "STRASSE", "STRAẞE", "ſk", "s\u212a", "kelvin \u212a",
+	}
+	for _, rs := range patterns {
+		for _, ci := range []bool{false, true} {
+			fp := compileDFA(rs, ci)
+			if fp == nil {
+				t.Errorf("%q (case insensitive %v) should compile to a DFA", rs, ci)
+				continue
+			}
+			prefix := "^"
+			if ci {
+				prefix = "(?i)^"
+			}
+			re := regexp.MustCompile(prefix + "(?:" + rs + ")")
+			for _, input := range inputs {
+				expected := -1
+				if loc := re.FindStringIndex(input); loc != nil {
+					expected = loc[1]
+				}
+				if n := fp(input); n != expected {
+					t.Errorf("%q (case insensitive %v) on %q: expected %d, got %d", rs, ci, input, expected, n)
+				}
+			}
+		}
+	}
+}
+
+func TestDFAFallback(t *testing.T) {
+	for _, rs := range []string{`\p{L}+`, `abc$`, `\bfoo`, `(?m)^a`, `a{1000}b{1000}c{1000}|x`} {
+		if compileDFA(rs, false) != nil {
+			t.Errorf("%q should not compile to a DFA", rs)
+		}
+	}
+	// unsupported patterns still work through regexp
+	p := NewRegexParser(func(s string) string { return s }, `\p{L}+`, false, false)
+	if p.fastPath != nil {
+		t.Error("expected the regexp fallback")
+	}
+	if n, err := Parse[string](p, NewScanner[string]("größe", nil)); err != nil || n.Payload != "größe" {
+		t.Errorf("unexpected result %q %v", n.Payload, err)
+	}
+}
+
+func TestDFAFastPathInParser(t *testing.T) {
+	p := NewRegexParser(func(s string) string { return s }, `(true|false)`, false, true)
+	if p.fastPath == nil {
+		t.Fatal("(true|false) should use a fast path")
+	}
+	if n, err := Parse[string](p, NewScanner[string](" false", SkipWhitespaceRegex)); err != nil || n.Payload != "false" {
+		t.Errorf("unexpected result %q %v", n.Payload, err)
+	}
+	if _, err := Parse[string](p, NewScanner[string]("falsey", SkipWhitespaceRegex)); err == nil {
+		t.Error("false must end at a word boundary")
+	}
+}
+
+func BenchmarkDFABool(b *testing.B) {
+	fp := compileDFA(`(true|false)`, false)
+	re := regexp.MustCompile(`^(?:(true|false))`)
+	b.Run("dfa", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fp("false,")
+		}
+	})
+	b.Run("regexp", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			re.FindStringIndex("false,")
+		}
+	})
+}
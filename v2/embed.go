@@ -0,0 +1,269 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+// EmbedParser parses a region of the input with a different grammar context:
+// its own skipper and its own word-break definition. Typical uses are JSON
+// paths, regex literals or scheme code embedded in SQL.
+//
+// Without a region parser, the inner parser runs on the remaining input and
+// consumes as much as it matches. With a region parser (see SetRegion), the
+// region is matched in the host grammar first, optionally unescaped, and the
+// inner parser must consume the whole region.
+//
+// The inner parser runs on a scanner of its own, so memoization of host and
+// embedded grammar never mixes. Positions of failures inside the region are
+// mapped back into the host input, see Scanner.SourcePos.
+type EmbedParser[T any] struct {
+	inner    Parser[T]
+	region   Parser[T]
+	unescape func(string) (string, []int, bool)
+	skipper  Skipper
+	words    *WordClass
+	pool     sync.Pool
+}
+
+// NewEmbedParser constructs an EmbedParser that matches inner with the given
+// skipper (nil for none).
+func NewEmbedParser[T any](inner Parser[T], skipper Skipper) *EmbedParser[T] {
+	return &EmbedParser[T]{inner: inner, skipper: skipper}
+}
+
+// Set updates the inner parser. This can be used to construct recursive parsers.
+func (p *EmbedParser[T]) Set(inner Parser[T]) {
+	p.inner = inner
+}
+
+// SetWordClass sets which characters form words inside the embedded region.
+// nil restores DefaultWordClass.
+func (p *EmbedParser[T]) SetWordClass(words *WordClass) {
+	p.words = words
+}
+
+// SetRegion restricts the embedded grammar to the text matched by region. If
+// unescape is not nil, it is applied to the region text and the inner parser
+// sees the unescaped content instead. unescape returns the content and, for
+// every content byte plus the end position, the offset in the region text it
+// was decoded from. See UnquoteDoubled and UnquoteBackslash.
+func (p *EmbedParser[T]) SetRegion(region Parser[T], unescape func(string) (string, []int, bool)) {
+	p.region = region
+	p.unescape = unescape
+}
+
+// Match skips leading whitespace with the host skipper and matches the inner
+// parser on an embedded scanner.
+func (p *EmbedParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
+	startPosition := s.position
+	s.Skip()
+	regionStart := s.position
+
+	content := s.remainingInput
+	var offsets []int
+	if p.region != nil {
+		mark := s.traceMark()
+		_, ok := s.applyRule(p.region)
+		s.traceDrop(mark) // the inner parse replaces the region
+		if !ok {
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+		content = s.input[regionStart:s.position]
+		if p.unescape != nil {
+			var ok bool
+			content, offsets, ok = p.unescape(content)
+			if !ok {
+				s.setPosition(startPosition)
+				return Node[T]{}, false
+			}
+			for i := range offsets {
+				offsets[i] += regionStart
+			}
+		}
+	}
+	regionEnd := s.position
+
+	sub, _ := p.pool.Get().(*Scanner[T])
+	if sub == nil {
+		sub = NewScanner[T]("", nil)
+	}
+	sub.words = p.words
+	sub.Reset(content, nil)
+	sub.skipper = p.skipper
+	sub.parent = s
+	sub.version = s.version
+	sub.UserData = s.UserData
+	sub.deferred = s.deferred
+	sub.trace = s.trace
+	sub.base = regionStart
+	sub.offsets = offsets
+
+	node, ok := sub.applyRule(p.inner)
+	if ok && p.region != nil {
+		// a region must be consumed completely
+		sub.Skip()
+		ok = len(sub.remainingInput) == 0
+	}
+	if !ok {
+		pos, failedParsers := sub.farthestFailure()
+		if pos < sub.position {
+			pos, failedParsers = sub.position, nil
+		}
+		if offsets != nil {
+			pos = offsets[pos]
+		} else {
+			pos += regionStart
+		}
+		s.noteEmbedFailure(pos, failedParsers)
+		p.release(sub)
+		s.setPosition(startPosition)
+		return Node[T]{}, false
+	}
+
+	if p.region != nil {
+		s.setPosition(regionEnd)
+	} else {
+		s.setPosition(regionStart + sub.position)
+	}
+	p.release(sub)
+	return node, true
+}
+
+func (p *EmbedParser[T]) release(sub *Scanner[T]) {
+	sub.parent = nil
+	sub.offsets = nil
+	sub.UserData = nil
+	sub.deferred = nil
+	sub.trace = nil
+	p.pool.Put(sub)
+}
+
+// UnquoteDoubled returns an unescape function for SetRegion that strips the
+// surrounding quotes from a literal and collapses doubled quote characters
+// into one, as in SQL string literals.
+func UnquoteDoubled(quote byte) func(string) (string, []int, bool) {
+	return func(raw string) (string, []int, bool) {
+		if len(raw) < 2 || raw[0] != quote || raw[len(raw)-1] != quote {
+			return "", nil, false
+		}
+		content := make([]byte, 0, len(raw)-2)
+		offsets := make([]int, 0, len(raw)-1)
+		i := 1
+		for i < len(raw)-1 {
+			if raw[i] == quote {
+				if raw[i+1] != quote || i+1 == len(raw)-1 {
+					return "", nil, false // unescaped quote inside the literal
+				}
+				content = append(content, quote)
+				offsets = append(offsets, i)
+				i += 2
+				continue
+			}
+			content = append(content, raw[i])
+			offsets = append(offsets, i)
+			i++
+		}
+		offsets = append(offsets, len(raw)-1)
+		return string(content), offsets, true
+	}
+}
+
+// UnquoteBackslash returns an unescape function for SetRegion that strips the
+// surrounding quotes from a literal like "a\"b" and decodes the backslash
+// escapes \n, \r, \t, \0, \xHH and \uHHHH. Any other escaped character stands
+// for itself.
+func UnquoteBackslash(quote byte) func(string) (string, []int, bool) {
+	return func(raw string) (string, []int, bool) {
+		if len(raw) < 2 || raw[0] != quote || raw[len(raw)-1] != quote {
+			return "", nil, false
+		}
+		content := make([]byte, 0, len(raw)-2)
+		offsets := make([]int, 0, len(raw)-1)
+		end := len(raw) - 1
+		i := 1
+		for i < end {
+			c := raw[i]
+			if c == quote {
+				return "", nil, false // unescaped quote inside the literal
+			}
+			if c != '\\' {
+				content = append(content, c)
+				offsets = append(offsets, i)
+				i++
+				continue
+			}
+			if i+1 >= end {
+				return "", nil, false // dangling backslash
+			}
+			start := i
+			switch e := raw[i+1]; e {
+			case 'n':
+				content = append(content, '\n')
+				i += 2
+			case 'r':
+				content = append(content, '\r')
+				i += 2
+			case 't':
+				content = append(content, '\t')
+				i += 2
+			case '0':
+				content = append(content, 0)
+				i += 2
+			case 'x', 'u':
+				digits := 2
+				if e == 'u' {
+					digits = 4
+				}
+				if i+2+digits > end {
+					return "", nil, false
+				}
+				var r rune
+				for _, h := range []byte(raw[i+2 : i+2+digits]) {
+					v, ok := hexValue(h)
+					if !ok {
+						return "", nil, false
+					}
+					r = r<<4 | rune(v)
+				}
+				if e == 'x' {
+					content = append(content, byte(r))
+				} else {
+					content = utf8.AppendRune(content, r)
+				}
+				i += 2 + digits
+			default:
+				content = append(content, e)
+				i += 2
+			}
+			for len(offsets) < len(content) {
+				offsets = append(offsets, start)
+			}
+		}
+		offsets = append(offsets, end)
+		return string(content), offsets, true
+	}
+}
+
+func hexValue(b byte) (byte, bool) {
+	switch {
+	case b >= '0' && b <= '9':
+		return b - '0', true
+	case b >= 'a' && b <= 'f':
+		return b - 'a' + 10, true
+	case b >= 'A' && b <= 'F':
+		return b - 'A' + 10, true
+	}
+	return 0, false
+}
@@ -0,0 +1,107 @@
+package packrat
+
+import "testing"
+
+func TestEmbedSkipper(t *testing.T) {
+	x := NewAtomParser("x", "x", false, true)
+	inner := NewManyParser(func(s string, a ...string) string { return s }, x, nil)
+	embed := NewEmbedParser[string](inner, CSkipper)
+	p := NewAndParser(func(s string, a ...string) string { return a[1] }, NewAtomParser("", "<", false, false), embed, NewAtomParser("", ">", false, false))
+
+	// the host has no skipper, but the embedded region skips comments
+	scanner := NewScanner[string]("<x /* c */ x>", nil)
+	n, err := Parse(p, scanner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != "x /* c */ x" {
+		t.Errorf("unexpected payload %q", n.Payload)
+	}
+}
+
+func TestEmbedWordChars(t *testing.T) {
+	foo := NewAtomParser("foo", "foo", false, true)
+	embed := NewEmbedParser[string](foo, nil)
+
+	scanner := NewScanner[string]("foo-bar", nil)
+	if _, err := ParsePartial(embed, scanner); err != nil {
+		t.Error("foo should match in front of '-' with default word chars")
+	}
+
+	embed.SetWordClass(DefaultWordClass.With("-"))
+	scanner = NewScanner[string]("foo-bar", nil)
+	if _, err := ParsePartial(embed, scanner); err == nil {
+		t.Error("foo should not match inside the word foo-bar")
+	}
+}
+
+func TestEmbedUnescapedRegion(t *testing.T) {
+	path := NewRegexParser(func(s string) string { return s }, `[$.a-z']+`, false, false)
+	embed := NewEmbedParser[string](path, nil)
+	embed.SetRegion(NewRegexParser(func(s string) string { return s }, `'(?:[^']|'')*'`, false, false), UnquoteDoubled('\''))
+	p := NewAndParser(func(s string, a ...string) string { return a[1] }, NewAtomParser("", "SELECT", true, true), embed)
+
+	scanner := NewScanner[string]("SELECT '$.a''b'", SkipWhitespaceRegex)
+	n, err := Parse(p, scanner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != "$.a'b" {
+		t.Errorf("unexpected payload %q", n.Payload)
+	}
+
+	// the failure inside the region is reported at the original position
+	scanner = NewScanner[string]("SELECT '$.a''!'", SkipWhitespaceRegex)
+	_, err = Parse(p, scanner)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if err.Position != 13 {
+		t.Errorf("expected error at position 13, got %d", err.Position)
+	}
+}
+
+func TestEmbedSourcePos(t *testing.T) {
+	var pos int
+	inner := NewAndParser(func(s string, a ...string) string { return s }, NewAtomParser("", "a", false, false), NewAtomParser("", "b", false, false))
+	probe := &positionProbe[string]{pos: &pos}
+	embed := NewEmbedParser[string](NewAndParser(func(s string, a ...string) string { return s }, inner, probe), nil)
+	embed.SetRegion(NewRegexParser(func(s string) string { return s }, `"(?:[^"\\]|\\.)*"`, false, false), UnquoteBackslash('"'))
+
+	scanner := NewScanner[string](`  "\x61b"`, SkipWhitespaceRegex)
+	if _, err := Parse[string](embed, scanner); err != nil {
+		t.Fatal(err)
+	}
+	if pos != 8 {
+		t.Errorf("expected end of content to map to 8, got %d", pos)
+	}
+}
+
+func TestUnquoteBackslash(t *testing.T) {
+	content, offsets, ok := UnquoteBackslash('"')(`"a\nü\""`)
+	if !ok {
+		t.Fatal("literal should be accepted")
+	}
+	if content != "a\nü\"" {
+		t.Errorf("unexpected content %q", content)
+	}
+	expected := []int{1, 2, 4, 5, 6, 8}
+	for i, o := range expected {
+		if offsets[i] != o {
+			t.Errorf("offset %d: expected %d, got %d", i, o, offsets[i])
+		}
+	}
+	if _, _, ok := UnquoteBackslash('"')(`"a"b"`); ok {
+		t.Error("unescaped quote should be rejected")
+	}
+}
+
+// positionProbe matches the empty string and records the source position.
+type positionProbe[T any] struct {
+	pos *int
+}
+
+func (p *positionProbe[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	*p.pos = s.SourcePos(s.position)
+	return Node[T]{}, true
+}
@@ -0,0 +1,194 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"unsafe"
+)
+
+// EventHandler receives the events of an EventStream. Positions are byte
+// offsets in the stream. text is only valid during the call.
+type EventHandler interface {
+	// Enter and Exit enclose the events of a named rule (see NamedParser).
+	Enter(rule string, pos int)
+	Exit(rule string, pos int)
+	// Token reports matched text: a terminal parser, or a named rule that
+	// only wraps one.
+	Token(rule, text string, pos int)
+}
+
+// EventStream parses a stream of items, like the statements of an SQL dump
+// or the records of a JSON log, and reports them as events instead of
+// building payloads. No callbacks run, except for context callbacks and the
+// callbacks they need (see SetDeferred).
+//
+// An item is final once it ends at least the lookahead window (see
+// SetLookahead) before the end of the input read so far, or the stream
+// ended. Only then are its events emitted, so events are never retracted,
+// and only then is its memory released. So the memory is bounded by a small
+// multiple of the largest item plus the lookahead window, not by the input.
+// Likewise, a syntax error is reported as soon as the farthest failure is
+// the lookahead window before the end of the input read so far. Parsers must
+// not look further than the lookahead window beyond the end of an item or,
+// when they fail, beyond the position they were tried at; tokens must be
+// shorter than the window.
+type EventStream[T any] struct {
+	item      Parser[T]
+	skipper   Skipper
+	handler   EventHandler
+	lookahead int
+}
+
+// NewEventStream constructs an EventStream that matches item repeatedly. The
+// skipper skips whitespace between items (nil for none).
+func NewEventStream[T any](item Parser[T], skipper Skipper, handler EventHandler) *EventStream[T] {
+	return &EventStream[T]{item: item, skipper: skipper, handler: handler, lookahead: 64 * 1024}
+}
+
+// SetLookahead sets the lookahead window in bytes. The default is 64 KiB.
+func (e *EventStream[T]) SetLookahead(n int) {
+	e.lookahead = max(n, 1)
+}
+
+// Parse reads r until EOF and emits the events of all items. Line and
+// Column of a returned ParserError count from the start of the stream;
+// Position is relative to Input, the part of the stream that was parsed.
+func (e *EventStream[T]) Parse(r io.Reader) error {
+	s := NewScanner[T]("", nil)
+	s.SetDeferred(true)
+	s.trace = &traceStore[T]{}
+	chunk := max(e.lookahead, 4096)
+
+	var buf []byte
+	base, line, column := 0, 1, 1 // stream position of buf[0]
+	eof := false
+	readMore := func() error {
+		// read a whole chunk, so that small reads do not cause a reparse
+		// each, and at least as much as is left of an unfinished item, so
+		// that a large item is parsed a constant number of times on average
+		n := max(chunk, len(buf))
+		buf = slices.Grow(buf, n)
+		want := len(buf) + n
+		for !eof && len(buf) < want {
+			n, err := r.Read(buf[len(buf):want])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		// parse all items that are final in the input read so far
+		s.Reset(unsafe.String(unsafe.SliceData(buf), len(buf)), nil)
+		s.skipper = e.skipper
+		consumed := 0
+		for {
+			s.Skip()
+			if len(s.remainingInput) == 0 {
+				if eof {
+					return nil
+				}
+				break
+			}
+			start := s.position
+			node, ok := s.applyRule(e.item)
+			// the item may turn out differently with more input unless
+			// the parse ended the lookahead window before the end
+			settled := len(buf) - e.lookahead
+			if s.abortErr != nil {
+				if !eof && s.abortSpan.End > settled {
+					break
+				}
+				return e.streamError(s.abortError(e.item), line, column)
+			}
+			if !ok || s.position == start {
+				if pos, _ := s.farthestFailure(); !eof && pos > settled {
+					break
+				}
+				return e.streamError(s.failureError(e.item), line, column)
+			}
+			if !eof && s.position > settled {
+				break
+			}
+			e.emit(s.trace, node.trace, base)
+			consumed = s.position
+		}
+
+		if nl := bytes.Count(buf[:consumed], []byte{'\n'}); nl > 0 {
+			line += nl
+			column = consumed - bytes.LastIndexByte(buf[:consumed], '\n')
+		} else {
+			column += consumed
+		}
+		base += consumed
+		buf = buf[:copy(buf, buf[consumed:])]
+		if err := readMore(); err != nil {
+			return err
+		}
+	}
+}
+
+// streamError moves the location of err from the window to the stream.
+func (e *EventStream[T]) streamError(err *ParserError[T], line, column int) *ParserError[T] {
+	if err.Line == 1 {
+		err.Column += column - 1
+	}
+	err.Line += line - 1
+	return err
+}
+
+// emit reports the trace node id and its children.
+func (e *EventStream[T]) emit(st *traceStore[T], id int32, base int) {
+	if id == 0 {
+		return
+	}
+	n := st.node(id)
+	if named, ok := n.rule.(*NamedParser[T]); ok {
+		if st.isChain(id) {
+			e.handler.Token(named.name, n.span.Text(), base+n.span.Start)
+			return
+		}
+		e.handler.Enter(named.name, base+n.span.Start)
+		for _, c := range st.childIDs(id) {
+			e.emit(st, c, base)
+		}
+		e.handler.Exit(named.name, base+n.span.End)
+		return
+	}
+	if n.count == 0 {
+		if n.span.End > n.span.Start {
+			e.handler.Token(ParserName(n.rule), n.span.Text(), base+n.span.Start)
+		}
+		return
+	}
+	for _, c := range st.childIDs(id) {
+		e.emit(st, c, base)
+	}
+}
+
+// isChain reports whether the trace node id leads to a single terminal.
+func (st *traceStore[T]) isChain(id int32) bool {
+	for {
+		n := st.node(id)
+		switch n.count {
+		case 0:
+			return true
+		case 1:
+			id = st.children[n.first]
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package packrat
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type eventRecorder struct {
+	events []string
+}
+
+func (r *eventRecorder) Enter(rule string, pos int) {
+	r.events = append(r.events, fmt.Sprintf("<%s@%d", rule, pos))
+}
+
+func (r *eventRecorder) Exit(rule string, pos int) {
+	r.events = append(r.events, fmt.Sprintf("%s@%d>", rule, pos))
+}
+
+func (r *eventRecorder) Token(rule, text string, pos int) {
+	r.events = append(r.events, fmt.Sprintf("%s:%s@%d", rule, text, pos))
+}
+
+func recordGrammar() Parser[int] {
+	cb := func(s string, a ...int) int { panic("callbacks must not run") }
+	key := NewNamedParser[int]("key", NewRegexParser(func(s string) int { panic("callbacks must not run") }, `[a-z]+`, false, true))
+	number := NewNamedParser[int]("number", NewCharClassParser(func(s string) int { panic("callbacks must not run") }, NewCharClass().Spec("0-9", false), 1, 0, true))
+	// the first alternative backtracks after matching key
+	call := NewNamedParser[int]("call", NewAndParser(cb, key, NewAtomParser(0, "(", false, true), NewAtomParser(0, ")", false, true)))
+	value := NewOrParser[int](call, number, key)
+	field := NewNamedParser[int]("field", NewAndParser(cb, key, NewAtomParser(0, ":", false, true), value))
+	return NewNamedParser[int]("record", NewAndParser(cb, NewAtomParser(0, "{", false, true), NewKleeneParser(cb, field, NewAtomParser(0, ",", false, true)), NewAtomParser(0, "}", false, true)))
+}
+
+func TestEventStream(t *testing.T) {
+	input := "{a: 1, b: c}\n{d: f()}\n\n{}\n"
+	for _, lookahead := range []int{1, 4, 1000} {
+		r := &eventRecorder{}
+		stream := NewEventStream[int](recordGrammar(), WhitespaceSkipper, r)
+		stream.SetLookahead(lookahead)
+		if err := stream.Parse(iotest.OneByteReader(strings.NewReader(input))); err != nil {
+			t.Fatal(err)
+		}
+		expected := `<record@0 "{":{@0 <field@1 key:a@1 ":"::@2 number:1@4 field@5> ",":,@5 <field@7 key:b@7 ":"::@8 key:c@10 field@11> "}":}@11 record@12> ` +
+			`<record@13 "{":{@13 <field@14 key:d@14 ":"::@15 <call@17 key:f@17 "(":(@18 ")":)@19 call@20> field@20> "}":}@20 record@21> ` +
+			`<record@23 "{":{@23 "}":}@24 record@25>`
+		if got := strings.Join(r.events, " "); got != expected {
+			t.Errorf("lookahead %d: unexpected events\n%s\n%s", lookahead, got, expected)
+		}
+	}
+}
+
+func TestEventStreamError(t *testing.T) {
+	r := &eventRecorder{}
+	stream := NewEventStream[int](recordGrammar(), WhitespaceSkipper, r)
+	stream.SetLookahead(2)
+	err := stream.Parse(strings.NewReader("{a: 1}\n{b: 2}\n{c: 3,, d: 4}\n"))
+	perr, ok := err.(*ParserError[int])
+	if !ok {
+		t.Fatalf("expected a parser error, got %v", err)
+	}
+	if perr.Line != 3 || !strings.HasPrefix(perr.Input[perr.Position:], ", d: 4}") {
+		t.Errorf("unexpected location %d:%d %q", perr.Line, perr.Column, perr.Input[perr.Position:])
+	}
+	// the complete items before the error have been reported
+	if len(r.events) == 0 || r.events[len(r.events)-1] != "record@13>" {
+		t.Errorf("unexpected events %v", r.events)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestEventStreamEarlyError(t *testing.T) {
+	// the error is reported without reading the rest of the stream
+	r := &countingReader{r: io.MultiReader(strings.NewReader("{a: 1}\n{b: 2,, c: 3}\n"), &recordReader{n: 1000000})}
+	stream := NewEventStream[int](recordGrammar(), WhitespaceSkipper, &countingHandler{})
+	stream.SetLookahead(64)
+	err := stream.Parse(r)
+	perr, ok := err.(*ParserError[int])
+	if !ok || perr.Line != 2 || perr.Column != 7 {
+		t.Fatalf("expected a parser error at 2:7, got %v", err)
+	}
+	if r.n > 64*1024 {
+		t.Errorf("read %d bytes before reporting the error", r.n)
+	}
+}
+
+// recordReader produces n records without holding them in memory.
+type recordReader struct {
+	n, i int
+	buf  string
+}
+
+func (r *recordReader) Read(p []byte) (int, error) {
+	if r.buf == "" {
+		if r.i == r.n {
+			return 0, io.EOF
+		}
+		r.buf = fmt.Sprintf("{id: %d, name: x}\n", r.i)
+		r.i++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+type countingHandler struct {
+	records int
+}
+
+func (h *countingHandler) Enter(rule string, pos int) {
+	if rule == "record" {
+		h.records++
+	}
+}
+func (h *countingHandler) Exit(rule string, pos int)        {}
+func (h *countingHandler) Token(rule, text string, pos int) {}
+
+func TestEventStreamLarge(t *testing.T) {
+	h := &countingHandler{}
+	stream := NewEventStream[int](recordGrammar(), WhitespaceSkipper, h)
+	stream.SetLookahead(64)
+	if err := stream.Parse(&recordReader{n: 20000}); err != nil {
+		t.Fatal(err)
+	}
+	if h.records != 20000 {
+		t.Errorf("expected 20000 records, got %d", h.records)
+	}
+}
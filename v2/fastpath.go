@@ -52,6 +52,11 @@ func detectFastPath(rs string, caseInsensitive bool) func(string) int {
 		return fp
 	}
 
+	// Category H: everything else a byte-level DFA can handle
+	if fp := compileDFA(rs, caseInsensitive); fp != nil {
+		return fp
+	}
+
 	return nil
 }
 
@@ -0,0 +1,246 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Grammar is a versioned handle on a grammar that can be extended while
+// other goroutines are parsing with it, e.g. to register new operators or
+// statement types at runtime.
+//
+// Extensions never modify the alternatives a running parse sees. Extend
+// stages its changes, builds new alternatives for the affected OrParsers and
+// then publishes them as a new grammar version. Parses started with
+// Grammar.Parse are pinned to the version that was current when they started
+// and finish against it. Alternatives of old versions are dropped as soon as
+// no parse uses them anymore.
+//
+// Calling OrParser.Set or LongestParser.Set directly on a grammar that is in
+// use is not safe in this sense: it discards all versions.
+type Grammar[T any] struct {
+	root    Parser[T]
+	mu      sync.Mutex
+	version uint64
+	active  map[uint64]int
+	ors     map[*atomic.Pointer[orAlternatives[T]]]bool // OrParsers and LongestParsers that keep older versions
+}
+
+// GrammarExtension collects the changes of one Grammar.Extend call.
+type GrammarExtension[T any] struct {
+	changes map[*OrParser[T]][]Parser[T]
+	order   []*OrParser[T]
+}
+
+func NewGrammar[T any](root Parser[T]) *Grammar[T] {
+	return &Grammar[T]{root: root, version: 1, active: make(map[uint64]int), ors: make(map[*atomic.Pointer[orAlternatives[T]]]bool)}
+}
+
+// Root returns the start rule of the grammar.
+func (g *Grammar[T]) Root() Parser[T] {
+	return g.root
+}
+
+// Version returns the current grammar version. It starts at 1 and increases
+// with every Extend.
+func (g *Grammar[T]) Version() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.version
+}
+
+// alternatives returns the staged alternatives of p.
+func (e *GrammarExtension[T]) alternatives(p *OrParser[T]) []Parser[T] {
+	if alts, ok := e.changes[p]; ok {
+		return alts
+	}
+	return p.current.Load().subParser
+}
+
+func (e *GrammarExtension[T]) stage(p *OrParser[T], alts []Parser[T]) {
+	if _, ok := e.changes[p]; !ok {
+		e.order = append(e.order, p)
+	}
+	e.changes[p] = alts
+}
+
+// Append adds alternatives with the lowest priority to p.
+func (e *GrammarExtension[T]) Append(p *OrParser[T], alternatives ...Parser[T]) {
+	old := e.alternatives(p)
+	alts := make([]Parser[T], 0, len(old)+len(alternatives))
+	e.stage(p, append(append(alts, old...), alternatives...))
+}
+
+// Prepend adds alternatives with the highest priority to p.
+func (e *GrammarExtension[T]) Prepend(p *OrParser[T], alternatives ...Parser[T]) {
+	old := e.alternatives(p)
+	alts := make([]Parser[T], 0, len(old)+len(alternatives))
+	e.stage(p, append(append(alts, alternatives...), old...))
+}
+
+// Set replaces the alternatives of p.
+func (e *GrammarExtension[T]) Set(p *OrParser[T], alternatives ...Parser[T]) {
+	e.stage(p, append([]Parser[T](nil), alternatives...))
+}
+
+// Extend applies the changes made by fn as one new grammar version. Parses
+// that are already running are not affected. Char maps are rebuilt for the
+// changed OrParsers and for those OrParsers and LongestParsers whose first
+// bytes depend on them.
+func (g *Grammar[T]) Extend(fn func(e *GrammarExtension[T])) {
+	e := &GrammarExtension[T]{changes: make(map[*OrParser[T]][]Parser[T])}
+	fn(e)
+	if len(e.order) == 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	version := g.version + 1
+
+	var published []*orAlternatives[T]
+	publish := func(current *atomic.Pointer[orAlternatives[T]], alts []Parser[T]) {
+		a := &orAlternatives[T]{version: version, subParser: alts}
+		a.prev.Store(current.Load())
+		current.Store(a)
+		g.ors[current] = true
+		published = append(published, a)
+	}
+	for _, p := range e.order {
+		publish(&p.current, e.changes[p])
+	}
+
+	// OrParsers and LongestParsers that reach a changed OrParser in their
+	// first byte analysis need a new char map, too
+	walkParsers[T](g.root, make(map[any]bool), func(q Parser[T]) {
+		var current *atomic.Pointer[orAlternatives[T]]
+		switch p := q.(type) {
+		case *OrParser[T]:
+			if _, changed := e.changes[p]; changed {
+				return
+			}
+			current = &p.current
+		case *LongestParser[T]:
+			current = &p.current
+		default:
+			return
+		}
+		visited := make(map[any]bool)
+		for _, child := range current.Load().subParser {
+			parserFirstBytes[T](child, visited)
+		}
+		for _, c := range e.order {
+			if visited[any(c)] {
+				publish(current, current.Load().subParser)
+				return
+			}
+		}
+	})
+
+	// build the char maps before the version becomes visible
+	for _, a := range published {
+		a.build()
+	}
+	g.version = version
+	g.prune()
+}
+
+// Parse parses the input of the scanner like Parse, pinned to the current
+// grammar version.
+func (g *Grammar[T]) Parse(s *Scanner[T]) (Node[T], *ParserError[T]) {
+	defer g.release(g.pin(s))
+	return Parse[T](g.root, s)
+}
+
+// ParsePartial parses a prefix of the input of the scanner like ParsePartial,
+// pinned to the current grammar version.
+func (g *Grammar[T]) ParsePartial(s *Scanner[T]) (Node[T], *ParserError[T]) {
+	defer g.release(g.pin(s))
+	return ParsePartial[T](g.root, s)
+}
+
+func (g *Grammar[T]) pin(s *Scanner[T]) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s.version = g.version
+	g.active[g.version]++
+	return g.version
+}
+
+func (g *Grammar[T]) release(version uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.active[version]--
+	if g.active[version] == 0 {
+		delete(g.active, version)
+		if version < g.version {
+			g.prune()
+		}
+	}
+}
+
+// prune drops alternatives that no running parse can see anymore. The caller
+// must hold g.mu.
+func (g *Grammar[T]) prune() {
+	oldest := g.version
+	for v := range g.active {
+		oldest = min(oldest, v)
+	}
+	for current := range g.ors {
+		a := current.Load()
+		for a.version > oldest {
+			prev := a.prev.Load()
+			if prev == nil {
+				break
+			}
+			a = prev
+		}
+		a.prev.Store(nil)
+		if a == current.Load() {
+			delete(g.ors, current)
+		}
+	}
+}
+
+// walkParsers calls visit for every parser reachable from p.
+func walkParsers[T any](p Parser[T], visited map[any]bool, visit func(Parser[T])) {
+	if p == nil || visited[any(p)] {
+		return
+	}
+	visited[any(p)] = true
+	visit(p)
+
+	var children []Parser[T]
+	switch pp := p.(type) {
+	case *AndParser[T]:
+		children = pp.subParser
+	case *OrParser[T]:
+		children = pp.current.Load().subParser
+	case *LongestParser[T]:
+		children = pp.current.Load().subParser
+	case *KleeneParser[T]:
+		children = []Parser[T]{pp.subParser, pp.sepParser}
+	case *ManyParser[T]:
+		children = []Parser[T]{pp.subParser, pp.sepParser}
+	case *MaybeParser[T]:
+		children = []Parser[T]{pp.subParser}
+	case *NotParser[T]:
+		children = append([]Parser[T]{pp.mainParser}, pp.notParser...)
+	case *NamedParser[T]:
+		children = []Parser[T]{pp.subParser}
+	case *EmbedParser[T]:
+		children = []Parser[T]{pp.inner, pp.region}
+	case *LengthPrefixedParser[T]:
+		children = []Parser[T]{pp.length, pp.body}
+	}
+	for _, child := range children {
+		walkParsers[T](child, visited, visit)
+	}
+}
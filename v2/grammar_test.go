@@ -0,0 +1,136 @@
+package packrat
+
+import (
+	"sync"
+	"testing"
+)
+
+// extendingParser extends the grammar when it is matched
+type extendingParser struct {
+	g      *Grammar[int]
+	extend func(e *GrammarExtension[int])
+}
+
+func (p *extendingParser) Match(s *Scanner[int]) (Node[int], bool) {
+	if len(s.remainingInput) == 0 || s.remainingInput[0] != '!' {
+		return Node[int]{}, false
+	}
+	s.setPosition(s.position + 1)
+	p.g.Extend(p.extend)
+	return Node[int]{}, true
+}
+
+func TestGrammarExtend(t *testing.T) {
+	value := NewOrParser[int](NewAtomParser(1, "a", false, true))
+	g := NewGrammar[int](NewKleeneParser(func(s string, a ...int) int { return len(a) }, value, nil))
+	if _, err := g.Parse(NewScanner[int]("a b", SkipWhitespaceRegex)); err == nil {
+		t.Fatal("b is not part of the grammar yet")
+	}
+	g.Extend(func(e *GrammarExtension[int]) {
+		e.Append(value, NewAtomParser(2, "b", false, true))
+	})
+	if g.Version() != 2 {
+		t.Errorf("unexpected version %d", g.Version())
+	}
+	if n, err := g.Parse(NewScanner[int]("a b a", SkipWhitespaceRegex)); err != nil || n.Payload != 3 {
+		t.Errorf("extended grammar should match: %v", err)
+	}
+}
+
+func TestGrammarRunningParse(t *testing.T) {
+	value := NewOrParser[int](NewAtomParser(1, "a", false, true))
+	g := NewGrammar[int](NewKleeneParser(func(s string, a ...int) int { return len(a) }, value, nil))
+	g.Extend(func(e *GrammarExtension[int]) {
+		e.Append(value, &extendingParser{g: g, extend: func(e *GrammarExtension[int]) {
+			e.Append(value, NewAtomParser(2, "b", false, true))
+		}})
+	})
+
+	// the parse that triggers the extension still sees the old grammar
+	if _, err := g.Parse(NewScanner[int]("a ! b", SkipWhitespaceRegex)); err == nil {
+		t.Error("running parse must not see the extension")
+	}
+	if _, err := g.Parse(NewScanner[int]("a b", SkipWhitespaceRegex)); err != nil {
+		t.Errorf("next parse should see the extension: %v", err)
+	}
+	// plain Parse always uses the newest alternatives
+	if _, err := Parse[int](g.Root(), NewScanner[int]("a ! b", SkipWhitespaceRegex)); err != nil {
+		t.Errorf("unpinned parse should see the extension: %v", err)
+	}
+}
+
+func TestGrammarDependentCharMap(t *testing.T) {
+	operator := NewOrParser[int](NewAtomParser(1, "+", false, true))
+	token := NewOrParser[int](NewAtomParser(0, "a", false, true), operator)
+	g := NewGrammar[int](NewKleeneParser(func(s string, a ...int) int { return len(a) }, token, nil))
+	if _, err := g.Parse(NewScanner[int]("a + a", SkipWhitespaceRegex)); err != nil {
+		t.Fatal(err)
+	}
+	g.Extend(func(e *GrammarExtension[int]) {
+		e.Prepend(operator, NewAtomParser(2, "*", false, true))
+	})
+	// token dispatches on the first byte and must learn about the new operator
+	if _, err := g.Parse(NewScanner[int]("a * a + a", SkipWhitespaceRegex)); err != nil {
+		t.Errorf("dependent char map was not rebuilt: %v", err)
+	}
+}
+
+func TestGrammarPrune(t *testing.T) {
+	value := NewOrParser[int](NewAtomParser(1, "a", false, true))
+	g := NewGrammar[int](value)
+	for _, atom := range []string{"b", "c", "d"} {
+		atom := atom
+		g.Extend(func(e *GrammarExtension[int]) {
+			e.Append(value, NewAtomParser(2, atom, false, true))
+		})
+	}
+	if value.current.Load().prev.Load() != nil {
+		t.Error("old versions should be dropped when no parse uses them")
+	}
+	if len(g.ors) != 0 {
+		t.Error("grammar should not track OrParsers without old versions")
+	}
+}
+
+func TestGrammarConcurrent(t *testing.T) {
+	value := NewOrParser[int](NewAtomParser(1, "a", false, true))
+	g := NewGrammar[int](NewKleeneParser(func(s string, a ...int) int { return len(a) }, value, NewAtomParser(0, ",", false, true)))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := NewScanner[int]("", SkipWhitespaceRegex)
+			for j := 0; j < 200; j++ {
+				s.Reset("a, a, a", SkipWhitespaceRegex)
+				if n, err := g.Parse(s); err != nil || n.Payload != 3 {
+					t.Error("parse failed during extension")
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		g.Extend(func(e *GrammarExtension[int]) {
+			e.Append(value, NewAtomParser(2, "b", false, true))
+		})
+	}
+	wg.Wait()
+}
+
+func TestGrammarLongest(t *testing.T) {
+	operator := NewOrParser[int](NewAtomParser(1, "+", false, true))
+	token := NewLongestParser[int](NewAtomParser(0, "a", false, true), operator)
+	g := NewGrammar[int](NewKleeneParser(func(s string, a ...int) int { return len(a) }, token, nil))
+	if _, err := g.Parse(NewScanner[int]("a + a", SkipWhitespaceRegex)); err != nil {
+		t.Fatal(err)
+	}
+	g.Extend(func(e *GrammarExtension[int]) {
+		e.Append(operator, NewAtomParser(2, "*", false, true))
+	})
+	// the LongestParser dispatches on the first byte and must learn about the
+	// new operator
+	if n, err := g.Parse(NewScanner[int]("a * a + a", SkipWhitespaceRegex)); err != nil || n.Payload != 5 {
+		t.Errorf("LongestParser char map was not rebuilt: %v", err)
+	}
+}
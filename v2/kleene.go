@@ -10,13 +10,12 @@ package packrat
 type KleeneParser[T any] struct {
 	callback func(string, ...T) T
 	subParser, sepParser Parser[T]
-	buf []T
-	depth int
 	NoMemo bool
+	contextCallback func(Context[T], string, ...T) (T, error)
 }
 
 func NewKleeneParser[T any](callback func(string, ...T) T, subparser Parser[T], sepparser Parser[T]) *KleeneParser[T] {
-	return &KleeneParser[T]{callback: callback, subParser: subparser, sepParser: sepparser, buf: make([]T, 0, 8)}
+	return &KleeneParser[T]{callback: callback, subParser: subparser, sepParser: sepparser}
 }
 
 func (p *KleeneParser[T]) Set(embedded Parser[T], separator Parser[T]) {
@@ -24,24 +23,27 @@ func (p *KleeneParser[T]) Set(embedded Parser[T], separator Parser[T]) {
 	p.sepParser = separator
 }
 
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). It replaces the callback
+// given to the constructor.
+func (p *KleeneParser[T]) SetContextCallback(callback func(Context[T], string, ...T) (T, error)) {
+	p.contextCallback = callback
+}
+
 // Match matches the embedded parser or the empty string.
 func (p *KleeneParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
-	var nodes []T
-	if p.depth == 0 {
-		nodes = p.buf[:0]
-	} else {
-		nodes = make([]T, 0, 8)
-	}
-	p.depth++
 	start := s.position
+	mark := s.deferMark()
+	argMark := len(s.args)
 
 	i := 0
 	lastValidPosition := s.position
 	applyFn := s.applyRule
 	if p.NoMemo {
-		applyFn = func(rule Parser[T]) (Node[T], bool) { return rule.Match(s) }
+		applyFn = s.matchNoMemo
 	}
 	for {
+		itemMark := s.traceMark()
 		if i > 0 && p.sepParser != nil {
 			_, ok := applyFn(p.sepParser)
 			if !ok {
@@ -52,22 +54,51 @@ func (p *KleeneParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 
 		node, ok := applyFn(p.subParser)
 		if !ok {
+			s.traceDrop(itemMark)
 			break
 		}
 
-		nodes = append(nodes, node.Payload)
+		if s.deferred != nil {
+			s.deferChild(node)
+		} else {
+			s.args = append(s.args, node.Payload)
+		}
 		lastValidPosition = s.position
 	}
 	s.setPosition(lastValidPosition)
 
-	// grow buf for next time if outermost call
-	if p.depth == 1 && cap(nodes) > cap(p.buf) {
-		p.buf = nodes[:0]
+	if s.deferred != nil && p.contextCallback != nil && !s.resolveChildren(mark) {
+		// the callback can fail, so it runs now (see SetDeferred)
+		s.args = s.args[:argMark]
+		s.setPosition(start)
+		return Node[T]{}, false
 	}
-	p.depth--
+	node, ok := p.result(s, start, mark, s.args[argMark:])
+	s.args = s.args[:argMark]
+	return node, ok
+}
 
+// result runs the callback of the match from start with the payloads of the
+// items.
+func (p *KleeneParser[T]) result(s *Scanner[T], start, mark int, nodes []T) (Node[T], bool) {
+	if s.deferred != nil && p.contextCallback == nil {
+		return s.deferMatch(p, s.input[start:], s.position-start, start, mark), true
+	}
+	if p.contextCallback != nil {
+		ctx := s.context(s.tokenStart(start), s.position)
+		v, err := p.contextCallback(ctx, s.input[start:s.position], nodes...)
+		return s.callbackResult(v, err, ctx.Span, start)
+	}
 	if len(nodes) == 0 {
 		return Node[T]{Payload: p.callback("")}, true
 	}
-	return Node[T]{p.callback(s.input[start:s.position], nodes...)}, true
+	return Node[T]{Payload: p.callback(s.input[start:s.position], nodes...)}, true
+}
+
+func (p *KleeneParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	text := d.input[:d.n]
+	if len(args) == 0 {
+		return p.callback("")
+	}
+	return p.callback(text, args...)
 }
@@ -0,0 +1,156 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// ColumnUnit is the unit columns are counted in.
+type ColumnUnit int
+
+const (
+	// ColumnBytes counts bytes of UTF-8, like the Column of ParserError.
+	ColumnBytes ColumnUnit = iota
+	// ColumnRunes counts Unicode code points.
+	ColumnRunes
+	// ColumnUTF16 counts UTF-16 code units, like the Language Server
+	// Protocol and JavaScript do.
+	ColumnUTF16
+)
+
+// lineIndex holds the offsets at which the lines of a source start. It
+// belongs to one source and is built on the first lookup, so spans can keep
+// it after the scanner was Reset and share it across goroutines.
+type lineIndex struct {
+	source string
+	once   sync.Once
+	starts []int
+}
+
+func (ix *lineIndex) build() {
+	ix.starts = []int{0}
+	for pos := 0; ; {
+		i := strings.IndexByte(ix.source[pos:], '\n')
+		if i < 0 {
+			break
+		}
+		pos += i + 1
+		ix.starts = append(ix.starts, pos)
+	}
+}
+
+// lineCol returns the 1-based line and column of the byte offset pos.
+func (ix *lineIndex) lineCol(pos int, unit ColumnUnit) (line, column int) {
+	ix.once.Do(ix.build)
+	pos = max(0, min(pos, len(ix.source)))
+	line = sort.Search(len(ix.starts), func(i int) bool { return ix.starts[i] > pos })
+	return line, columnWidth(ix.source[ix.starts[line-1]:pos], unit) + 1
+}
+
+// offset returns the byte offset of the 1-based line and column or -1 if the
+// source has no such position. The column may point just behind the last
+// character of the line.
+func (ix *lineIndex) offset(line, column int, unit ColumnUnit) int {
+	ix.once.Do(ix.build)
+	if line < 1 || line > len(ix.starts) || column < 1 {
+		return -1
+	}
+	start, end := ix.starts[line-1], len(ix.source)
+	if line < len(ix.starts) {
+		end = ix.starts[line] - 1
+	}
+	text := ix.source[start:end]
+	if unit == ColumnBytes {
+		if column-1 > len(text) {
+			return -1
+		}
+		return start + column - 1
+	}
+	width := 0
+	for i, r := range text {
+		if width == column-1 {
+			return start + i
+		}
+		width += runeWidth(r, unit)
+		if width > column-1 {
+			// the column is inside a surrogate pair
+			return -1
+		}
+	}
+	if width == column-1 {
+		return end
+	}
+	return -1
+}
+
+// columnWidth returns the width of text in unit.
+func columnWidth(text string, unit ColumnUnit) int {
+	switch unit {
+	case ColumnRunes:
+		return utf8.RuneCountInString(text)
+	case ColumnUTF16:
+		width := 0
+		for _, r := range text {
+			width += runeWidth(r, ColumnUTF16)
+		}
+		return width
+	}
+	return len(text)
+}
+
+func runeWidth(r rune, unit ColumnUnit) int {
+	if unit == ColumnUTF16 && r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// lineIndex returns the line index of the outermost source.
+func (s *Scanner[T]) lineIndex() *lineIndex {
+	for s.parent != nil {
+		s = s.parent
+	}
+	source := s.input
+	if s.tokens != nil {
+		source = s.source
+	}
+	if s.lines == nil || len(s.lines.source) != len(source) || unsafe.StringData(s.lines.source) != unsafe.StringData(source) {
+		s.lines = &lineIndex{source: source}
+	}
+	return s.lines
+}
+
+// LineCol returns the 1-based line and byte column of the scanner position
+// pos. Positions of embedded and token scanners are mapped to the outermost
+// source first. The line starts are indexed on the first call, so that
+// callbacks can look up locations in O(log lines).
+func (s *Scanner[T]) LineCol(pos int) (line, column int) {
+	return s.LineColUnit(pos, ColumnBytes)
+}
+
+// LineColUnit is like LineCol, but counts the column in unit.
+func (s *Scanner[T]) LineColUnit(pos int, unit ColumnUnit) (line, column int) {
+	return s.lineIndex().lineCol(s.SourcePos(pos), unit)
+}
+
+// Offset returns the byte offset in the outermost source of the 1-based
+// line and byte column, or -1 if there is no such position. It is the
+// inverse of LineCol for scanners that are not embedded or tokenized.
+func (s *Scanner[T]) Offset(line, column int) int {
+	return s.OffsetUnit(line, column, ColumnBytes)
+}
+
+// OffsetUnit is like Offset, but counts the column in unit.
+func (s *Scanner[T]) OffsetUnit(line, column int, unit ColumnUnit) int {
+	return s.lineIndex().offset(line, column, unit)
+}
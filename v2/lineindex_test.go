@@ -0,0 +1,122 @@
+package packrat
+
+import (
+	"testing"
+)
+
+func TestLineCol(t *testing.T) {
+	s := NewScanner[int]("ab\nüx😀y\n\nz", nil)
+	cases := []struct {
+		pos, line, bytes, runes, utf16 int
+	}{
+		{0, 1, 1, 1, 1},
+		{2, 1, 3, 3, 3},
+		{3, 2, 1, 1, 1},
+		{5, 2, 3, 2, 2},
+		{6, 2, 4, 3, 3},
+		{10, 2, 8, 4, 5},
+		{12, 3, 1, 1, 1},
+		{13, 4, 1, 1, 1},
+		{14, 4, 2, 2, 2},
+	}
+	for _, c := range cases {
+		if line, col := s.LineCol(c.pos); line != c.line || col != c.bytes {
+			t.Errorf("LineCol(%d) = %d:%d, expected %d:%d", c.pos, line, col, c.line, c.bytes)
+		}
+		if line, col := s.LineColUnit(c.pos, ColumnRunes); line != c.line || col != c.runes {
+			t.Errorf("rune column of %d = %d:%d, expected %d:%d", c.pos, line, col, c.line, c.runes)
+		}
+		if line, col := s.LineColUnit(c.pos, ColumnUTF16); line != c.line || col != c.utf16 {
+			t.Errorf("UTF-16 column of %d = %d:%d, expected %d:%d", c.pos, line, col, c.line, c.utf16)
+		}
+		if pos := s.Offset(c.line, c.bytes); pos != c.pos {
+			t.Errorf("Offset(%d, %d) = %d, expected %d", c.line, c.bytes, pos, c.pos)
+		}
+		if pos := s.OffsetUnit(c.line, c.runes, ColumnRunes); pos != c.pos {
+			t.Errorf("rune offset of %d:%d = %d, expected %d", c.line, c.runes, pos, c.pos)
+		}
+		if pos := s.OffsetUnit(c.line, c.utf16, ColumnUTF16); pos != c.pos {
+			t.Errorf("UTF-16 offset of %d:%d = %d, expected %d", c.line, c.utf16, pos, c.pos)
+		}
+	}
+	// beyond the line end, inside a surrogate pair and outside of the input
+	for _, c := range [][3]int{{1, 4, int(ColumnBytes)}, {2, 4, int(ColumnUTF16)}, {0, 1, int(ColumnBytes)}, {5, 1, int(ColumnBytes)}, {3, 2, int(ColumnRunes)}} {
+		if pos := s.OffsetUnit(c[0], c[1], ColumnUnit(c[2])); pos != -1 {
+			t.Errorf("offset of %d:%d should not exist, got %d", c[0], c[1], pos)
+		}
+	}
+}
+
+func TestLineIndexReset(t *testing.T) {
+	var span Span
+	p := NewRegexParser(func(s string) int { return 0 }, `d`, false, true)
+	p.SetContextCallback(func(ctx Context[int], match string) (int, error) {
+		span = ctx.Span
+		return 0, nil
+	})
+	s := NewScanner[int]("a\nb\nc\nd", nil)
+	s.setPosition(6)
+	if _, ok := p.Match(s); !ok {
+		t.Fatal("d should match")
+	}
+	s.Reset("x\ny", nil)
+	if line, col := s.LineCol(2); line != 2 || col != 1 {
+		t.Errorf("the index was not rebuilt after Reset: %d:%d", line, col)
+	}
+	// spans keep the index of their own source
+	if line, col := span.LineColumn(); line != 4 || col != 1 {
+		t.Errorf("span lost its source after Reset: %d:%d", line, col)
+	}
+}
+
+func TestLineColSubScanners(t *testing.T) {
+	lexer := NewLexer(WhitespaceSkipper)
+	lexer.AddRegex("ident", `[a-z]+`, false)
+	source := "a\n  bc d"
+	tokens, err := lexer.Tokenize(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewTokenScanner[int](source, tokens)
+	if line, col := s.LineCol(1); line != 2 || col != 3 {
+		t.Errorf("token 1 should be at 2:3, got %d:%d", line, col)
+	}
+
+	var line, col int
+	inner := NewRegexParser(func(s string) int { return 0 }, `[0-9]+`, false, true)
+	inner.SetContextCallback(func(ctx Context[int], match string) (int, error) {
+		line, col = ctx.Scanner.LineCol(ctx.Scanner.position - len(match))
+		return 0, nil
+	})
+	embed := NewEmbedParser[int](inner, nil)
+	embed.SetRegion(NewRegexParser(func(s string) int { return 0 }, `'[^']*'`, false, true), UnquoteDoubled('\''))
+	if _, err := Parse[int](embed, NewScanner[int]("\n '42'", SkipWhitespaceRegex)); err != nil {
+		t.Fatal(err)
+	}
+	if line != 2 || col != 3 {
+		t.Errorf("embedded match should be at 2:3, got %d:%d", line, col)
+	}
+}
+
+// Columns in errors are 1-based and count bytes from the start of the line,
+// on the first line as well as on later ones.
+func TestErrorColumn(t *testing.T) {
+	b := NewAtomParser(0, "b", false, true)
+	p := NewAndParser(func(s string, a ...int) int { return 0 }, NewAtomParser(0, "a", false, true), b, b)
+	for _, c := range []struct {
+		input        string
+		line, column int
+	}{
+		{"a c", 1, 2},
+		{"a b b c", 1, 7},
+		{"a\nb\nb\nc", 4, 1},
+		{"a\n b\n", 2, 3},
+		{"a\n b b c", 2, 6},
+		{"a\nb\nb\n  c", 4, 3},
+	} {
+		_, err := Parse[int](p, NewScanner[int](c.input, SkipWhitespaceRegex))
+		if err == nil || err.Line != c.line || err.Column != c.column {
+			t.Errorf("%q: expected an error at %d:%d, got %v", c.input, c.line, c.column, err)
+		}
+	}
+}
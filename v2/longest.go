@@ -0,0 +1,101 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"sync/atomic"
+)
+
+// TieBreak decides between two alternatives of a LongestParser that consumed
+// the same amount of input. It receives the indices of the current winner and
+// of the challenger and returns true if the challenger wins.
+type TieBreak func(current, candidate int) bool
+
+// TieBreakFirst prefers the alternative listed first, e.g. a keyword listed
+// before an identifier of the same length.
+func TieBreakFirst(current, candidate int) bool {
+	return false
+}
+
+// TieBreakLast prefers the alternative listed last.
+func TieBreakLast(current, candidate int) bool {
+	return true
+}
+
+// LongestParser is a lexer-style choice: unlike the ordered choice of the
+// OrParser, it tries all plausible alternatives and keeps the one that
+// consumed the most input. So operators like ">", ">>" and ">>=" can be listed
+// in any order. Its alternatives are versioned like the ones of the OrParser
+// (see Grammar).
+type LongestParser[T any] struct {
+	current  atomic.Pointer[orAlternatives[T]]
+	tieBreak TieBreak
+}
+
+func NewLongestParser[T any](subparser ...Parser[T]) *LongestParser[T] {
+	p := &LongestParser[T]{tieBreak: TieBreakFirst}
+	p.current.Store(&orAlternatives[T]{subParser: subparser})
+	return p
+}
+
+func (p *LongestParser[T]) Set(embedded ...Parser[T]) {
+	p.current.Store(&orAlternatives[T]{subParser: embedded})
+}
+
+// SetTieBreak sets how alternatives of equal length are chosen. The default
+// is TieBreakFirst.
+func (p *LongestParser[T]) SetTieBreak(tieBreak TieBreak) {
+	p.tieBreak = tieBreak
+}
+
+// SetCharMap installs a manual first-byte dispatch table, overriding auto-build.
+func (p *LongestParser[T]) SetCharMap(cm [256][]int) {
+	cur := p.current.Load()
+	p.current.Store(&orAlternatives[T]{subParser: cur.subParser, charMap: &cm})
+}
+
+// Match tries all sub-parsers whose first byte matches the current input
+// byte (see OrParser) and returns the result of the longest match.
+func (p *LongestParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	a := alternativesAt(&p.current, s.version)
+
+	origPosition := s.position
+	s.Skip()
+	skipPosition := s.position
+
+	var candidates []int
+	if s.position >= len(s.input) {
+		candidates = a.eofCandidates
+	} else {
+		candidates = a.charMap[s.input[s.position]]
+	}
+
+	best := -1
+	bestPosition := 0
+	var bestNode Node[T]
+	mark := s.traceMark()
+	for _, idx := range candidates {
+		node, ok := s.applyRule(a.subParser[idx])
+		if ok && (best < 0 || s.position > bestPosition || (s.position == bestPosition && p.tieBreak(best, idx))) {
+			best = idx
+			bestPosition = s.position
+			bestNode = node
+		}
+		s.traceDrop(mark)
+		s.setPosition(skipPosition)
+	}
+	if best < 0 {
+		s.setPosition(origPosition)
+		return Node[T]{}, false
+	}
+	if s.trace != nil && bestNode.trace != 0 {
+		s.trace.stack = append(s.trace.stack, bestNode.trace)
+	}
+	s.setPosition(bestPosition)
+	return bestNode, true
+}
@@ -0,0 +1,69 @@
+package packrat
+
+import "testing"
+
+func TestLongestOperators(t *testing.T) {
+	gt := NewAtomParser(">", ">", false, false)
+	shr := NewAtomParser(">>", ">>", false, false)
+	shrAssign := NewAtomParser(">>=", ">>=", false, false)
+	ge := NewAtomParser(">=", ">=", false, false)
+	op := NewLongestParser[string](gt, shr, ge, shrAssign)
+
+	for _, input := range []string{">", ">>", ">=", ">>="} {
+		n, err := Parse[string](op, NewScanner[string](input, nil))
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+		} else if n.Payload != input {
+			t.Errorf("%q: matched %q", input, n.Payload)
+		}
+	}
+
+	n, err := ParsePartial[string](op, NewScanner[string](">>>", nil))
+	if err != nil || n.Payload != ">>" {
+		t.Errorf("expected >> as longest prefix of >>>, got %q", n.Payload)
+	}
+}
+
+func TestLongestNumbers(t *testing.T) {
+	intP := NewRegexParser(func(s string) string { return "int" }, `-?[0-9]+`, false, true)
+	floatP := NewRegexParser(func(s string) string { return "float" }, `-?[0-9]+\.[0-9]+`, false, true)
+	num := NewLongestParser[string](intP, floatP)
+
+	for input, expected := range map[string]string{"42": "int", "4.2": "float", " -1.5": "float"} {
+		n, err := Parse[string](num, NewScanner[string](input, SkipWhitespaceRegex))
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+		} else if n.Payload != expected {
+			t.Errorf("%q: expected %s, got %s", input, expected, n.Payload)
+		}
+	}
+}
+
+func TestLongestTieBreak(t *testing.T) {
+	keyword := NewAtomParser("keyword", "select", true, true)
+	ident := NewRegexParser(func(s string) string { return "ident" }, `[a-z]+`, false, true)
+	p := NewLongestParser[string](keyword, ident)
+
+	if n, err := Parse[string](p, NewScanner[string]("select", nil)); err != nil || n.Payload != "keyword" {
+		t.Errorf("TieBreakFirst should choose the keyword, got %q", n.Payload)
+	}
+	if n, err := Parse[string](p, NewScanner[string]("selected", nil)); err != nil || n.Payload != "ident" {
+		t.Errorf("longer identifier should win, got %q", n.Payload)
+	}
+
+	p.SetTieBreak(TieBreakLast)
+	if n, err := Parse[string](p, NewScanner[string]("select", nil)); err != nil || n.Payload != "ident" {
+		t.Errorf("TieBreakLast should choose the identifier, got %q", n.Payload)
+	}
+}
+
+func TestLongestNoMatch(t *testing.T) {
+	p := NewLongestParser[string](NewAtomParser("a", "a", false, false), NewAtomParser("b", "b", false, false))
+	scanner := NewScanner[string]("c", nil)
+	if _, err := Parse[string](p, scanner); err == nil {
+		t.Error("expected no match")
+	}
+	if scanner.position != 0 {
+		t.Errorf("position should be restored, got %d", scanner.position)
+	}
+}
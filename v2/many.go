@@ -10,13 +10,12 @@ package packrat
 type ManyParser[T any] struct {
 	callback func(string, ...T) T
 	subParser, sepParser Parser[T]
-	buf []T
-	depth int
 	NoMemo bool
+	contextCallback func(Context[T], string, ...T) (T, error)
 }
 
 func NewManyParser[T any](callback func(string, ...T) T, subparser Parser[T], sepparser Parser[T]) *ManyParser[T] {
-	return &ManyParser[T]{callback: callback, subParser: subparser, sepParser: sepparser, buf: make([]T, 0, 8)}
+	return &ManyParser[T]{callback: callback, subParser: subparser, sepParser: sepparser}
 }
 
 func (p *ManyParser[T]) Set(embedded Parser[T], separator Parser[T]) {
@@ -24,23 +23,26 @@ func (p *ManyParser[T]) Set(embedded Parser[T], separator Parser[T]) {
 	p.sepParser = separator
 }
 
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). It replaces the callback
+// given to the constructor.
+func (p *ManyParser[T]) SetContextCallback(callback func(Context[T], string, ...T) (T, error)) {
+	p.contextCallback = callback
+}
+
 func (p *ManyParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
-	var nodes []T
-	if p.depth == 0 {
-		nodes = p.buf[:0]
-	} else {
-		nodes = make([]T, 0, 8)
-	}
-	p.depth++
 	start := s.position
+	mark := s.deferMark()
+	argMark := len(s.args)
 
 	i := 0
 	lastValidPos := s.position
 	applyFn := s.applyRule
 	if p.NoMemo {
-		applyFn = func(rule Parser[T]) (Node[T], bool) { return rule.Match(s) }
+		applyFn = s.matchNoMemo
 	}
 	for {
+		itemMark := s.traceMark()
 		if i > 0 && p.sepParser != nil {
 			_, ok := applyFn(p.sepParser)
 			if !ok {
@@ -51,23 +53,52 @@ func (p *ManyParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 
 		node, ok := applyFn(p.subParser)
 		if !ok {
+			s.traceDrop(itemMark)
 			break
 		}
 
-		nodes = append(nodes, node.Payload)
+		if s.deferred != nil {
+			s.deferChild(node)
+		} else {
+			s.args = append(s.args, node.Payload)
+		}
 		lastValidPos = s.position
 	}
 	s.setPosition(lastValidPos)
 
-	// grow buf for next time if outermost call
-	if p.depth == 1 && cap(nodes) > cap(p.buf) {
-		p.buf = nodes[:0]
+	if s.deferred != nil && p.contextCallback != nil && !s.resolveChildren(mark) {
+		// the callback can fail, so it runs now (see SetDeferred)
+		s.args = s.args[:argMark]
+		s.setPosition(start)
+		return Node[T]{}, false
 	}
-	p.depth--
+	node, ok := p.result(s, start, mark, s.args[argMark:])
+	s.args = s.args[:argMark]
+	return node, ok
+}
 
+// result runs the callback of the match from start with the payloads of the
+// items.
+func (p *ManyParser[T]) result(s *Scanner[T], start, mark int, nodes []T) (Node[T], bool) {
+	if s.deferred != nil && p.contextCallback == nil {
+		if len(s.deferred.stack) == mark {
+			return Node[T]{}, false
+		}
+		return s.deferMatch(p, s.input[start:], s.position-start, start, mark), true
+	}
+	if len(nodes) >= 1 && p.contextCallback != nil {
+		ctx := s.context(s.tokenStart(start), s.position)
+		v, err := p.contextCallback(ctx, s.input[start:s.position], nodes...)
+		return s.callbackResult(v, err, ctx.Span, start)
+	}
 	if len(nodes) >= 1 {
 		return Node[T]{Payload: p.callback(s.input[start:s.position], nodes...)}, true
 	}
 
 	return Node[T]{}, false
 }
+
+func (p *ManyParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	text := d.input[:d.n]
+	return p.callback(text, args...)
+}
@@ -30,5 +30,5 @@ func (p *MaybeParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 		return Node[T]{Payload: p.valueFalse}, true
 	}
 
-	return Node[T]{Payload: node.Payload}, true
+	return node, true
 }
@@ -0,0 +1,101 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"strconv"
+)
+
+// NamedParser gives a parser a rule name. It matches exactly what the sub
+// parser matches and passes its payload through. Rule names show up in error
+// messages and wherever a grammar is described.
+type NamedParser[T any] struct {
+	name      string
+	subParser Parser[T]
+	printer   func(*SyntaxNode[T], []Doc) Doc
+}
+
+func NewNamedParser[T any](name string, subparser Parser[T]) *NamedParser[T] {
+	return &NamedParser[T]{name: name, subParser: subparser}
+}
+
+// Set updates the sub parser. This can be used to construct recursive parsers.
+func (p *NamedParser[T]) Set(embedded Parser[T]) {
+	p.subParser = embedded
+}
+
+// Name returns the rule name.
+func (p *NamedParser[T]) Name() string {
+	return p.name
+}
+
+// SetPrinter installs how PrintTree prints nodes of the rule. The printer
+// receives the node and the documents of its children.
+func (p *NamedParser[T]) SetPrinter(printer func(n *SyntaxNode[T], children []Doc) Doc) {
+	p.printer = printer
+}
+
+func (p *NamedParser[T]) String() string {
+	return p.name
+}
+
+// Match matches the sub parser.
+func (p *NamedParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	return s.applyRule(p.subParser)
+}
+
+// ParserName describes a parser for humans: the rule name of a NamedParser,
+// the quoted text of an atom, the pattern of a regex, and the kind of parser
+// for all other combinators.
+func ParserName[T any](p Parser[T]) string {
+	switch pp := p.(type) {
+	case nil:
+		return "<nil>"
+	case *NamedParser[T]:
+		return pp.name
+	case *AtomParser[T]:
+		return strconv.Quote(pp.atom)
+	case *RegexParser[T]:
+		return "/" + pp.rs + "/"
+	case *CharClassParser[T]:
+		return "CharClass"
+	case *TokenParser[T]:
+		return pp.String()
+	case *AndParser[T]:
+		return "And"
+	case *OrParser[T]:
+		return "Or"
+	case *LongestParser[T]:
+		return "Longest"
+	case *KleeneParser[T]:
+		return "Kleene"
+	case *ManyParser[T]:
+		return "Many"
+	case *MaybeParser[T]:
+		return "Maybe"
+	case *NotParser[T]:
+		return "Not"
+	case *EmptyParser[T]:
+		return "Empty"
+	case *EndParser[T]:
+		return "End"
+	case *RestParser[T]:
+		return "Rest"
+	case *EmbedParser[T]:
+		return "Embed"
+	case *FixedUintParser[T]:
+		return "Uint" + strconv.Itoa(8*pp.size)
+	case *VarintParser[T]:
+		return "Varint"
+	case *LengthPrefixedParser[T]:
+		return "LengthPrefixed"
+	case interface{ String() string }:
+		return pp.String()
+	}
+	return "?"
+}
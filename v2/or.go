@@ -7,47 +7,89 @@
 
 package packrat
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 type OrParser[T any] struct {
+	current atomic.Pointer[orAlternatives[T]]
+}
+
+// orAlternatives is an immutable set of alternatives together with its char
+// map. Grammar extensions keep older sets reachable via prev so that parses
+// pinned to an older grammar version still see the alternatives they started
+// with (see Grammar).
+type orAlternatives[T any] struct {
+	version       uint64
 	subParser     []Parser[T]
 	charMap       *[256][]int
 	eofCandidates []int
-	charMapBuilt  bool
+	once          sync.Once
+	prev          atomic.Pointer[orAlternatives[T]]
 }
 
 func NewOrParser[T any](subparser ...Parser[T]) *OrParser[T] {
-	return &OrParser[T]{subParser: subparser}
+	p := &OrParser[T]{}
+	p.current.Store(&orAlternatives[T]{subParser: subparser})
+	return p
 }
 
 func (p *OrParser[T]) Set(embedded ...Parser[T]) {
-	p.subParser = embedded
-	p.charMap = nil
-	p.eofCandidates = nil
-	p.charMapBuilt = false
+	p.current.Store(&orAlternatives[T]{subParser: embedded})
 }
 
 // SetCharMap installs a manual first-byte dispatch table, overriding auto-build.
 func (p *OrParser[T]) SetCharMap(cm [256][]int) {
-	p.charMap = &cm
-	p.charMapBuilt = true
+	cur := p.current.Load()
+	p.current.Store(&orAlternatives[T]{subParser: cur.subParser, charMap: &cm})
+}
+
+// alternatives returns the newest alternatives that belong to the given
+// grammar version. Version 0 means the newest alternatives.
+func (p *OrParser[T]) alternatives(version uint64) *orAlternatives[T] {
+	return alternativesAt(&p.current, version)
+}
+
+// alternativesAt returns the alternatives of an OrParser or LongestParser for
+// the given grammar version with their char map built.
+func alternativesAt[T any](current *atomic.Pointer[orAlternatives[T]], version uint64) *orAlternatives[T] {
+	a := current.Load()
+	if version != 0 {
+		for a.version > version {
+			prev := a.prev.Load()
+			if prev == nil {
+				break
+			}
+			a = prev
+		}
+	}
+	a.build()
+	return a
+}
+
+func (a *orAlternatives[T]) build() {
+	a.once.Do(func() {
+		if a.charMap == nil {
+			a.charMap, a.eofCandidates = buildCharMap[T](a.subParser)
+		}
+	})
 }
 
 // Match tries sub-parsers until one succeeds. On first call, a charMap is
 // automatically built from the sub-parsers' first-byte sets. Only the
 // sub-parsers whose first byte matches the current input byte are tried.
 func (p *OrParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
-	if !p.charMapBuilt {
-		p.charMap, p.eofCandidates = buildCharMap[T](p.subParser)
-		p.charMapBuilt = true
-	}
+	a := p.alternatives(s.version)
 
 	origPosition := s.position
 	s.Skip()
 
 	if s.position >= len(s.input) {
-		for _, idx := range p.eofCandidates {
-			node, ok := s.applyRule(p.subParser[idx])
+		for _, idx := range a.eofCandidates {
+			node, ok := s.applyRule(a.subParser[idx])
 			if ok {
-				return Node[T]{Payload: node.Payload}, true
+				return node, true
 			}
 			s.setPosition(s.position)
 		}
@@ -55,12 +97,12 @@ func (p *OrParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 		return Node[T]{}, false
 	}
 
-	candidates := p.charMap[s.input[s.position]]
+	candidates := a.charMap[s.input[s.position]]
 	skipPosition := s.position
 	for _, idx := range candidates {
-		node, ok := s.applyRule(p.subParser[idx])
+		node, ok := s.applyRule(a.subParser[idx])
 		if ok {
-			return Node[T]{Payload: node.Payload}, true
+			return node, true
 		}
 		s.setPosition(skipPosition)
 	}
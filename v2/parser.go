@@ -9,6 +9,7 @@ package packrat
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -19,7 +20,11 @@ type Parser[T any] interface {
 }
 
 func (s *Scanner[T]) applyRule(rule Parser[T]) (Node[T], bool) {
+	if s.abortErr != nil {
+		return Node[T]{}, false
+	}
 	startPosition := s.position
+	mark := s.traceMark()
 
 	memmap := s.memoization[startPosition]
 	if memmap == nil {
@@ -27,14 +32,20 @@ func (s *Scanner[T]) applyRule(rule Parser[T]) (Node[T], bool) {
 		s.memoization[startPosition] = memmap
 	}
 
+	outer := s.first
 	m := s.Recall(rule, startPosition)
 	if m == nil {
 		lr := s.lrPool.Get().(*Lr[T])
 		*lr = Lr[T]{seed: Node[T]{}, seedOk: false, rule: rule, head: nil, next: s.invocationStack}
 		s.invocationStack = lr
-		m := &MemoEntry[T]{Lr: lr, Position: startPosition}
+		m := &MemoEntry[T]{Lr: lr, Position: startPosition, Start: startPosition}
 		memmap[rule] = m
+		s.first = -1
 		ans, ok := rule.Match(s)
+		m.Start = s.tokenStart(startPosition)
+		if ok && s.trace != nil {
+			ans = s.traceMatch(rule, m.Start, mark, ans)
+		}
 		s.invocationStack = s.invocationStack.next
 		m.Position = s.position
 		if lr.head != nil {
@@ -42,6 +53,10 @@ func (s *Scanner[T]) applyRule(rule Parser[T]) (Node[T], bool) {
 			lr.seedOk = ok
 			result, resultOk := s.LrAnswer(rule, startPosition, m)
 			s.lrPool.Put(lr)
+			if s.trace != nil {
+				s.traceKeep(mark, result, resultOk)
+			}
+			s.endRule(outer, resultOk, startPosition, m.Start)
 			return result, resultOk
 		}
 
@@ -49,6 +64,10 @@ func (s *Scanner[T]) applyRule(rule Parser[T]) (Node[T], bool) {
 		m.Ans = ans
 		m.Ok = ok
 		s.lrPool.Put(lr)
+		if s.trace != nil {
+			s.traceKeep(mark, ans, ok)
+		}
+		s.endRule(outer, ok, startPosition, m.Start)
 		return ans, ok
 	}
 
@@ -56,16 +75,45 @@ func (s *Scanner[T]) applyRule(rule Parser[T]) (Node[T], bool) {
 
 	if m.Lr != nil {
 		s.SetupLr(rule, m.Lr)
+		if s.trace != nil {
+			s.traceKeep(mark, m.Lr.seed, m.Lr.seedOk)
+		}
+		s.endRule(outer, m.Lr.seedOk, startPosition, m.Start)
 		return m.Lr.seed, m.Lr.seedOk
 	}
 
+	if s.trace != nil {
+		s.traceKeep(mark, m.Ans, m.Ok)
+	}
+	s.endRule(outer, m.Ok, startPosition, m.Start)
 	return m.Ans, m.Ok
 }
 
+// matchNoMemo matches rule without memoization, for the sub parsers of a
+// KleeneParser or ManyParser with NoMemo. While tracing, the match is recorded
+// like in applyRule, so that it gets a syntax tree node.
+func (s *Scanner[T]) matchNoMemo(rule Parser[T]) (Node[T], bool) {
+	if s.trace == nil {
+		return rule.Match(s)
+	}
+	startPosition, mark, outer := s.position, s.traceMark(), s.first
+	s.first = -1
+	ans, ok := rule.Match(s)
+	start := s.tokenStart(startPosition)
+	if ok {
+		ans = s.traceMatch(rule, start, mark, ans)
+	}
+	s.traceKeep(mark, ans, ok)
+	s.endRule(outer, ok, startPosition, start)
+	return ans, ok
+}
+
 var emptyString = ""
 
 type Node[T any] struct {
 	Payload  T
+	deriv    int32 // deferred derivation, see SetDeferred
+	trace    int32 // trace node, see traceStore
 }
 
 type ParserError[T any] struct {
@@ -75,9 +123,33 @@ type ParserError[T any] struct {
 	Position      int
 	FailedParsers []Parser[T]
 	Input         string
+
+	// Err is the error of a callback that aborted the parse, Span the match
+	// of the rule whose callback returned it
+	Err  error
+	Span Span
+
+	// Panic is the value of a recovered panic (see SetRecoverPanics),
+	// RulePath the rules that were running, outermost first, and Stack the
+	// stack trace of the panic
+	Panic    any
+	RulePath []string
+	Stack    []byte
+}
+
+// Unwrap returns the callback error, if any.
+func (e *ParserError[T]) Unwrap() error {
+	return e.Err
 }
 
 func (e *ParserError[T]) Error() string {
+	if e.Panic != nil {
+		return fmt.Sprintf("Parser panicked at line %d, column %d (position %d of input string): %v\r\nRule path: %s", e.Line, e.Column, e.Position+1, e.Panic, strings.Join(e.RulePath, " > "))
+	}
+	if e.Err != nil {
+		replacer := strings.NewReplacer("\r\n", "\\n", "\n", "\\n", "\t", "  ")
+		return fmt.Sprintf("Parser failed at line %d, column %d (position %d of input string): %v\r\nIn: %s", e.Line, e.Column, e.Position+1, e.Err, replacer.Replace(e.Span.Text()))
+	}
 	linestartpos := e.Position - 30
 
 	startpos := linestartpos
@@ -95,11 +167,15 @@ func (e *ParserError[T]) Error() string {
 
 	atomParsers := make(map[*AtomParser[T]]bool)
 	regexParsers := make(map[*RegexParser[T]]bool)
+	tokenParsers := make(map[*TokenParser[T]]bool)
 	eofParser := false
 	allskipws := true
+	var rules []string
 
 	for _, p := range e.FailedParsers {
 		switch pa := p.(type) {
+		case *NamedParser[T]:
+			rules = append(rules, pa.name)
 		case *AtomParser[T]:
 			atomParsers[pa] = true
 			if !pa.skipWs {
@@ -110,6 +186,8 @@ func (e *ParserError[T]) Error() string {
 			if !pa.skipWs {
 				allskipws = false
 			}
+		case *TokenParser[T]:
+			tokenParsers[pa] = true
 		case *EndParser[T]:
 			eofParser = true
 		}
@@ -139,6 +217,13 @@ func (e *ParserError[T]) Error() string {
 		expected.WriteString("\r\n")
 		count++
 	}
+	for r := range tokenParsers {
+		if count >= 5 {
+			break
+		}
+		expected.WriteString("- Token: " + r.String() + "\r\n")
+		count++
+	}
 	if eofParser && count < 5 {
 		expected.WriteString("- End of input\r\n")
 	}
@@ -165,77 +250,83 @@ func (e *ParserError[T]) Error() string {
 		}
 	}
 	builder.WriteString("^\r\n")
-	builder.WriteString("Expected one of " + strconv.Itoa(len(atomParsers)+len(regexParsers)) + " alternatives:\r\n" + expected.String() + "Found: " + strings.ReplaceAll(e.Input[e.Position:endpos], "\n", "\\n"))
+	if len(rules) > 0 {
+		sort.Strings(rules)
+		builder.WriteString("Rules tried here: " + strings.Join(rules, ", ") + "\r\n")
+	}
+	builder.WriteString("Expected one of " + strconv.Itoa(len(atomParsers)+len(regexParsers)+len(tokenParsers)) + " alternatives:\r\n" + expected.String() + "Found: " + strings.ReplaceAll(e.Input[e.Position:endpos], "\n", "\\n"))
 
 	return builder.String()
 }
 
-func ParsePartial[T any](p Parser[T], originalScanner *Scanner[T]) (Node[T], *ParserError[T]) {
-	node, ok := originalScanner.applyRule(p)
-	if ok {
-		return node, nil
+// errorInput returns the text and position errors are reported in: the
+// source text for token scanners, the input otherwise.
+func (s *Scanner[T]) errorInput(pos int) (string, int) {
+	if s.tokens != nil {
+		return s.source, s.SourcePos(pos)
 	}
+	return s.input, pos
+}
 
-	maxPos := 0
-	var failedParsers []Parser[T]
-	for index := len(originalScanner.input); index >= 0; index-- {
-		m := originalScanner.memoization[index]
-		if len(m) > 0 {
-			maxPos = index
-			for k := range m {
-				failedParsers = append(failedParsers, k)
+func ParsePartial[T any](p Parser[T], originalScanner *Scanner[T]) (result Node[T], err *ParserError[T]) {
+	if originalScanner.recoverPanics {
+		defer originalScanner.recoverPanic(p, &err)
+	}
+	node, ok := originalScanner.applyRule(p)
+	if originalScanner.abortErr != nil {
+		return Node[T]{}, originalScanner.abortError(p)
+	}
+	if ok {
+		if originalScanner.deferred != nil {
+			node = Node[T]{Payload: originalScanner.resolve(node)}
+			if originalScanner.abortErr != nil {
+				return Node[T]{}, originalScanner.abortError(p)
 			}
-			break
 		}
+		return node, nil
 	}
 
-	consumed := originalScanner.input[:maxPos]
-	line := strings.Count(consumed, "\n") + 1
-	lastBreak := strings.LastIndex(consumed, "\n")
-	if lastBreak < 0 {
-		lastBreak = 0
-	}
-	column := maxPos - lastBreak + 1
-	e := &ParserError[T]{FailedParsers: failedParsers, Parser: p, Line: line, Column: column, Position: maxPos, Input: originalScanner.input}
-	return Node[T]{}, e
+	return Node[T]{}, originalScanner.failureError(p)
 }
 
-func Parse[T any](p Parser[T], originalScanner *Scanner[T]) (Node[T], *ParserError[T]) {
+func Parse[T any](p Parser[T], originalScanner *Scanner[T]) (result Node[T], err *ParserError[T]) {
+	if originalScanner.recoverPanics {
+		defer originalScanner.recoverPanic(p, &err)
+	}
 	node, ok := originalScanner.applyRule(p)
+	if originalScanner.abortErr != nil {
+		return Node[T]{}, originalScanner.abortError(p)
+	}
 	if ok {
 		originalScanner.Skip()
 		if len(originalScanner.remainingInput) > 0 {
-			consumed := originalScanner.input[:originalScanner.position]
-			line := strings.Count(consumed, "\n") + 1
-			column := originalScanner.position - strings.LastIndex(consumed, "\n") + 1
-			e := &ParserError[T]{Parser: p, Line: line, Column: column, Position: originalScanner.position, Input: originalScanner.input}
-			return Node[T]{}, e
+			return Node[T]{}, originalScanner.trailingError(p)
 		}
 
-		return node, nil
-	}
-
-	maxPos := 0
-	var failedParsers []Parser[T]
-	for index := len(originalScanner.input); index >= 0; index-- {
-		m := originalScanner.memoization[index]
-		if len(m) > 0 {
-			maxPos = index
-			for k := range m {
-				failedParsers = append(failedParsers, k)
+		if originalScanner.deferred != nil {
+			node = Node[T]{Payload: originalScanner.resolve(node)}
+			if originalScanner.abortErr != nil {
+				return Node[T]{}, originalScanner.abortError(p)
 			}
-			break
 		}
+		return node, nil
 	}
 
-	consumed := originalScanner.input[:maxPos]
-	line := strings.Count(consumed, "\n") + 1
-	lastBreak := strings.LastIndex(consumed, "\n")
-	if lastBreak < 0 {
-		lastBreak = 0
-	}
-	column := maxPos - lastBreak + 1
-	e := &ParserError[T]{FailedParsers: failedParsers, Parser: p, Line: line, Column: column, Position: maxPos, Input: originalScanner.input}
+	return Node[T]{}, originalScanner.failureError(p)
+}
+
+// trailingError reports input left over after p matched.
+func (s *Scanner[T]) trailingError(p Parser[T]) *ParserError[T] {
+	input, pos := s.errorInput(s.position)
+	line, column := s.lineIndex().lineCol(pos, ColumnBytes)
+	return &ParserError[T]{Parser: p, Line: line, Column: column, Position: pos, Input: input}
+}
 
-	return Node[T]{}, e
+// failureError reports the farthest failure of a parse of p that did not
+// match.
+func (s *Scanner[T]) failureError(p Parser[T]) *ParserError[T] {
+	maxPos, failedParsers := s.farthestFailure()
+	input, maxPos := s.errorInput(maxPos)
+	line, column := s.lineIndex().lineCol(maxPos, ColumnBytes)
+	return &ParserError[T]{FailedParsers: failedParsers, Parser: p, Line: line, Column: column, Position: maxPos, Input: input}
 }
@@ -0,0 +1,328 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Doc is a document of the pretty printer: text with optional line breaks
+// that Pretty lays out for a width, after Wadler's "A prettier printer".
+// Docs are built with Text, Line, SoftLine, Group, Nest, Concat and Join.
+type Doc interface {
+	isDoc()
+}
+
+type textDoc string
+
+// lineDoc is a line break, or flat when its group fits on the line and the
+// break is not hard.
+type lineDoc struct {
+	flat    string
+	hard    bool
+	literal bool // no indentation behind the break
+}
+
+type groupDoc struct {
+	doc Doc
+}
+
+type nestDoc struct {
+	indent int
+	doc    Doc
+}
+
+type concatDoc []Doc
+
+func (textDoc) isDoc()   {}
+func (lineDoc) isDoc()   {}
+func (groupDoc) isDoc()  {}
+func (nestDoc) isDoc()   {}
+func (concatDoc) isDoc() {}
+
+// Text is literal text. It must not contain line breaks.
+func Text(s string) Doc {
+	return textDoc(s)
+}
+
+// Line is a line break that becomes a space if its group fits on the line.
+func Line() Doc {
+	return lineDoc{flat: " "}
+}
+
+// SoftLine is a line break that disappears if its group fits on the line.
+func SoftLine() Doc {
+	return lineDoc{}
+}
+
+// hardLine is a line break even in a flat group behind a comment. A line
+// break right behind it takes its place instead of adding an empty line.
+var hardLine Doc = lineDoc{hard: true}
+
+// literalLine is a hard line break inside verbatim text like a block comment,
+// the next line is not indented.
+var literalLine Doc = lineDoc{hard: true, literal: true}
+
+// Group lays out doc on one line if it fits into the width, otherwise all
+// lines of doc that are not in inner groups break.
+func Group(doc Doc) Doc {
+	return groupDoc{doc: doc}
+}
+
+// Nest indents the lines that break inside doc by indent more columns.
+func Nest(indent int, doc Doc) Doc {
+	return nestDoc{indent: indent, doc: doc}
+}
+
+// Concat puts docs one after another.
+func Concat(docs ...Doc) Doc {
+	return concatDoc(docs)
+}
+
+// Join puts sep between docs.
+func Join(sep Doc, docs ...Doc) Doc {
+	result := make(concatDoc, 0, 2*len(docs))
+	for i, d := range docs {
+		if i > 0 {
+			result = append(result, sep)
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+type layoutCmd struct {
+	indent int
+	flat   bool
+	doc    Doc
+}
+
+// Pretty lays out doc for a line width in runes. A group stays flat if it
+// and the text up to the next possible line break behind it fit; text that
+// is too long on its own overflows.
+func Pretty(doc Doc, width int) string {
+	var b strings.Builder
+	column, indent := 0, -1 // indent is pending until the next text
+	broken := false         // behind a hardLine without text since
+	stack := []layoutCmd{{doc: doc}}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case textDoc:
+			if d == "" {
+				continue
+			}
+			if indent >= 0 {
+				b.WriteString(strings.Repeat(" ", indent))
+				indent = -1
+			}
+			broken = false
+			b.WriteString(string(d))
+			column += utf8.RuneCountInString(string(d))
+		case lineDoc:
+			if broken {
+				column, indent = c.indent, c.indent
+				continue
+			}
+			if c.flat && !d.hard {
+				stack = append(stack, layoutCmd{c.indent, true, textDoc(d.flat)})
+				continue
+			}
+			b.WriteByte('\n')
+			column, indent = c.indent, c.indent
+			if d.literal {
+				column, indent = 0, -1
+			}
+			broken = d.hard && !d.literal
+		case concatDoc:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, layoutCmd{c.indent, c.flat, d[i]})
+			}
+		case nestDoc:
+			stack = append(stack, layoutCmd{c.indent + d.indent, c.flat, d.doc})
+		case groupDoc:
+			flat := c.flat || fits(width-column, layoutCmd{c.indent, true, d.doc}, stack)
+			stack = append(stack, layoutCmd{c.indent, flat, d.doc})
+		}
+	}
+	return b.String()
+}
+
+// fits reports whether next and then rest fit into remaining runes up to the
+// first line break.
+func fits(remaining int, next layoutCmd, rest []layoutCmd) bool {
+	stack := []layoutCmd{next}
+	for remaining >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case textDoc:
+			remaining -= utf8.RuneCountInString(string(d))
+		case lineDoc:
+			if !c.flat || d.hard {
+				return true
+			}
+			remaining -= len(d.flat)
+		case concatDoc:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, layoutCmd{c.indent, c.flat, d[i]})
+			}
+		case nestDoc:
+			stack = append(stack, layoutCmd{c.indent + d.indent, c.flat, d.doc})
+		case groupDoc:
+			stack = append(stack, layoutCmd{c.indent, c.flat, d.doc})
+		}
+	}
+	return false
+}
+
+// PrintTree returns the document of a syntax tree (see ParseTree). Nodes of
+// rules with a printer (see NamedParser.SetPrinter) are printed by it, given
+// the documents of their children: the nearest named nodes and tokens below,
+// like in a Query. Tokens print their text. Other nodes put the documents of
+// their children one after another, separated by a space where the source
+// had whitespace between them.
+//
+// The comments of a tree from ParseTreeTrivia are kept with the token they
+// are trivia of, block comments verbatim. A comment ends the line if the
+// source broke the line behind it. The comments in front of the first and
+// behind the last token of a node with a printer surround the printed node,
+// so they are kept even if the printer leaves out e.g. the parentheses.
+func PrintTree[T any](n *SyntaxNode[T]) Doc {
+	return printTree(n, nil, nil)
+}
+
+// printTree prints n without the leading comments of the token first and
+// the trailing comments of the token last, which an enclosing node with a
+// printer puts around its document.
+func printTree[T any](n, first, last *SyntaxNode[T]) Doc {
+	if len(n.Children) == 0 {
+		var result concatDoc
+		if n != first {
+			result = leadingComments(n.Leading, result)
+		}
+		result = append(result, Text(n.Text()))
+		if n != last {
+			result = trailingComments(n.Trailing, result)
+		}
+		return result
+	}
+	children := visibleChildren(n, nil)
+	if named, ok := n.Parser.(*NamedParser[T]); ok && named.printer != nil {
+		head, tail := first, last
+		if tokens := n.tokens(nil); len(tokens) > 0 {
+			head, tail = tokens[0], tokens[len(tokens)-1]
+		}
+		docs := make([]Doc, len(children))
+		for i, c := range children {
+			docs[i] = printTree(c, head, tail)
+		}
+		var result concatDoc
+		if head != first {
+			result = leadingComments(head.Leading, result)
+		}
+		result = append(result, named.printer(n, docs))
+		if tail != last {
+			result = trailingComments(tail.Trailing, result)
+		}
+		return result
+	}
+	result := make(concatDoc, 0, 2*len(children))
+	for i, c := range children {
+		if i > 0 && children[i-1].Span.End < c.Span.Start && !endsLine(children[i-1]) {
+			result = append(result, Text(" "))
+		}
+		result = append(result, printTree(c, first, last))
+	}
+	return result
+}
+
+// leadingComments appends the comments in front of a token, each followed
+// by a line break if the source had one behind it, otherwise by a space.
+func leadingComments(trivia []Trivia, result concatDoc) concatDoc {
+	for i, t := range trivia {
+		if t.Kind == "whitespace" {
+			continue
+		}
+		result = append(result, comment(t))
+		if breakBehind(trivia[i:]) {
+			result = append(result, hardLine)
+		} else {
+			result = append(result, Text(" "))
+		}
+	}
+	return result
+}
+
+// trailingComments appends the comments behind a token, each behind a space
+// and followed by a line break if the source had one behind it.
+func trailingComments(trivia []Trivia, result concatDoc) concatDoc {
+	for i, t := range trivia {
+		if t.Kind == "whitespace" {
+			continue
+		}
+		result = append(result, Text(" "), comment(t))
+		if breakBehind(trivia[i:]) {
+			result = append(result, hardLine)
+		}
+	}
+	return result
+}
+
+// comment returns the document of a comment with its line breaks kept
+// verbatim, without the line break that ends a line comment.
+func comment(t Trivia) Doc {
+	lines := strings.Split(strings.TrimRight(t.Text(), "\r\n"), "\n")
+	docs := make([]Doc, len(lines))
+	for i, l := range lines {
+		docs[i] = Text(l)
+	}
+	return Join(literalLine, docs...)
+}
+
+// breakBehind reports whether the comment trivia[0] is followed by a line
+// break before the next comment.
+func breakBehind(trivia []Trivia) bool {
+	if strings.HasSuffix(trivia[0].Text(), "\n") {
+		return true
+	}
+	for _, t := range trivia[1:] {
+		if t.Kind != "whitespace" {
+			return false
+		}
+		if strings.Contains(t.Text(), "\n") {
+			return true
+		}
+	}
+	return false
+}
+
+// endsLine reports whether the trailing comments of the last token of n end
+// the line.
+func endsLine[T any](n *SyntaxNode[T]) bool {
+	tokens := n.tokens(nil)
+	if len(tokens) == 0 {
+		return false
+	}
+	trivia := tokens[len(tokens)-1].Trailing
+	for i := len(trivia) - 1; i >= 0; i-- {
+		if trivia[i].Kind != "whitespace" {
+			return breakBehind(trivia[i:])
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package packrat
+
+import (
+	"testing"
+)
+
+func TestPretty(t *testing.T) {
+	call := func(name string, args ...Doc) Doc {
+		return Group(Concat(Text(name+"("), Nest(2, Concat(SoftLine(), Join(Concat(Text(","), Line()), args...))), SoftLine(), Text(")")))
+	}
+	doc := call("f", Text("alpha"), call("g", Text("beta"), Text("gamma")), Text("delta"))
+	cases := []struct {
+		width    int
+		expected string
+	}{
+		{80, "f(alpha, g(beta, gamma), delta)"},
+		{25, "f(\n  alpha,\n  g(beta, gamma),\n  delta\n)"},
+		{10, "f(\n  alpha,\n  g(\n    beta,\n    gamma\n  ),\n  delta\n)"},
+	}
+	for _, c := range cases {
+		if result := Pretty(doc, c.width); result != c.expected {
+			t.Errorf("width %d: unexpected layout\n%s\nexpected\n%s", c.width, result, c.expected)
+		}
+	}
+
+	// the text behind a group up to the next break counts, empty lines get
+	// no indentation
+	doc = Concat(Group(Concat(Text("a"), Line(), Text("b"))), Text("cdef"), Nest(4, Concat(Line(), Line(), Text("x"))))
+	if result := Pretty(doc, 6); result != "a\nbcdef\n\n    x" {
+		t.Errorf("unexpected layout %q", result)
+	}
+}
+
+func TestPrintTree(t *testing.T) {
+	expr := NewOrParser[any]()
+	list := NewNamedParser[any]("list", NewAndParser[any](nil, NewAtomParser[any](nil, "(", false, true), NewKleeneParser[any](nil, expr, nil), NewAtomParser[any](nil, ")", false, true)))
+	atom := NewNamedParser[any]("atom", NewRegexParser[any](nil, `[^\s()]+`, false, true))
+	expr.Set(list, atom)
+	list.SetPrinter(func(n *SyntaxNode[any], children []Doc) Doc {
+		// children are the parentheses and the elements
+		return Group(Concat(Text("("), Nest(2, Join(Line(), children[1:len(children)-1]...)), Text(")")))
+	})
+
+	tree, err := ParseTree[any](expr, NewScanner[any]("(define (square x)\n   (*   x x))", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := PrintTree(tree)
+	if result := Pretty(doc, 80); result != "(define (square x) (* x x))" {
+		t.Errorf("unexpected layout %q", result)
+	}
+	if result := Pretty(doc, 20); result != "(define\n  (square x)\n  (* x x))" {
+		t.Errorf("unexpected layout %q", result)
+	}
+
+	// without printers, tokens keep a space where the source had any
+	where := queryTestTree(t, "WHERE a=1   AND\n f( x,NULL )")
+	if result := Pretty(PrintTree(where), 80); result != "WHERE a=1 AND f( x,NULL )" {
+		t.Errorf("unexpected default layout %q", result)
+	}
+
+	// comments are kept, line comments end the line
+	s := NewScanner[any]("WHERE a=1 /* one */  AND -- two\n f( x,NULL )", nil)
+	s.SetSkipper(SQLSkipper)
+	where, err = ParseTreeTrivia[any](rewriteTestGrammar(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = Group(PrintTree(where))
+	if result := Pretty(doc, 80); result != "WHERE a=1 /* one */ AND -- two\nf( x,NULL )" {
+		t.Errorf("unexpected layout with comments %q", result)
+	}
+
+	// block comments stay verbatim, comments around the parentheses a
+	// printer leaves out surround the printed node
+	s = NewScanner[any]("/* square */ (define (square x) -- doc\n    /* x\n   * x */ (* x x)) -- end", nil)
+	s.SetSkipper(SQLSkipper)
+	tree, err = ParseTreeTrivia[any](expr, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "/* square */ (define\n  (square x) -- doc\n  /* x\n   * x */ (* x x)) -- end"
+	if result := Pretty(PrintTree(tree), 30); result != expected {
+		t.Errorf("unexpected layout with comments %q", result)
+	}
+}
@@ -0,0 +1,391 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Query is a compiled pattern language over syntax trees (see ParseTree),
+// similar to tree-sitter queries. A query is a list of patterns:
+//
+//	(rule item...)  a node of the NamedParser rule; (_) is any named node
+//	"text"          a node that matched exactly text
+//	_               any node
+//
+// A pattern may be followed by captures like @name that record the matched
+// node. Items inside a node pattern are patterns for its children, which
+// match in order but need not be adjacent, and predicates:
+//
+//	(#eq? @a @b) (#eq? @a "text")   the texts are equal
+//	(#match? @a "regexp")           the text matches the regexp
+//	(#not-eq? ...) (#not-match? ...)
+//
+// The children of a node are the nearest named nodes and tokens below it;
+// the combinators in between, like And or Kleene, are skipped. An item
+// prefixed with descendant: matches a node anywhere below instead, child:
+// is the default. Line comments start with ';'.
+//
+//	(comparison (_) "=" descendant: (null) @n)
+//
+// A Query holds no state of a match and can be used concurrently.
+type Query struct {
+	patterns []queryPattern
+}
+
+type queryPattern struct {
+	root       *queryNode
+	predicates []*queryPredicate
+}
+
+type queryNode struct {
+	rule     string // "" for text and any
+	text     string
+	anyNode  bool
+	captures []string
+	items    []queryItem
+	// predicates inside the node, moved to the pattern when compiled
+	predicates []*queryPredicate
+}
+
+type queryItem struct {
+	descendant bool
+	node       *queryNode
+}
+
+type queryPredicate struct {
+	negated bool
+	regex   *regexp.Regexp
+	args    []queryArg
+}
+
+type queryArg struct {
+	capture bool
+	value   string
+}
+
+// QueryMatch is a match of a pattern of a Query.
+type QueryMatch[T any] struct {
+	// Pattern is the index of the pattern in the query, Node the node it
+	// matched
+	Pattern  int
+	Node     *SyntaxNode[T]
+	Captures []QueryCapture[T]
+}
+
+// QueryCapture is a node recorded by a capture of a pattern.
+type QueryCapture[T any] struct {
+	Name string
+	Node *SyntaxNode[T]
+}
+
+// Capture returns the first node captured as name, or nil.
+func (m QueryMatch[T]) Capture(name string) *SyntaxNode[T] {
+	for _, c := range m.Captures {
+		if c.Name == name {
+			return c.Node
+		}
+	}
+	return nil
+}
+
+// CompileQuery compiles a query. Syntax errors are returned as *ParserError.
+func CompileQuery(query string) (*Query, error) {
+	s := NewScanner[any](query, nil)
+	s.SetSkipper(CombineSkippers(WhitespaceSkipper, NewLineCommentSkipper(";")))
+	result, err := Parse[any](queryGrammar(), s)
+	if err != nil {
+		return nil, err
+	}
+	return result.Payload.(*Query), nil
+}
+
+// MustCompileQuery is like CompileQuery but panics on errors.
+func MustCompileQuery(query string) *Query {
+	q, err := CompileQuery(query)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// queryGrammar is the parser of the query language. The per-parse state is
+// in the scanner, so all compilations share it.
+var queryGrammar = sync.OnceValue(newQueryGrammar)
+
+func newQueryGrammar() Parser[any] {
+	ident := NewRegexParser[any](func(s string) any { return s }, `[A-Za-z_][A-Za-z0-9_.\-]*`, false, true)
+	str := NewRegexParser[any](nil, `"(?:[^"\\]|\\.)*"`, false, true)
+	str.SetContextCallback(func(ctx Context[any], s string) (any, error) {
+		text, err := strconv.Unquote(s)
+		return text, err
+	})
+	capture := NewRegexParser[any](func(s string) any { return s[1:] }, `@[A-Za-z_][A-Za-z0-9_.\-]*`, false, true)
+	lparen := NewAtomParser[any](nil, "(", false, true)
+	rparen := NewAtomParser[any](nil, ")", false, true)
+
+	arg := NewOrParser[any](
+		NewAndParser[any](func(s string, a ...any) any { return queryArg{capture: true, value: a[0].(string)} }, capture),
+		NewAndParser[any](func(s string, a ...any) any { return queryArg{value: a[0].(string)} }, str),
+	)
+	predicate := NewAndParser[any](nil, lparen, NewRegexParser[any](func(s string) any { return s }, `#[a-z\-]+\?`, false, true), NewManyParser[any](func(s string, a ...any) any { return append([]any(nil), a...) }, arg, nil), rparen)
+	predicate.SetContextCallback(func(ctx Context[any], s string, a ...any) (any, error) {
+		p, err := newQueryPredicate(a[1].(string), a[2].([]any))
+		return p, err
+	})
+
+	pattern := NewOrParser[any]()
+	axis := NewAndParser[any](func(s string, a ...any) any { return a[0] }, NewOrParser[any](NewAtomParser[any]("child", "child", false, true), NewAtomParser[any]("descendant", "descendant", false, true)), NewAtomParser[any](nil, ":", false, true))
+	item := NewOrParser[any](predicate, NewAndParser[any](func(s string, a ...any) any {
+		return queryItem{descendant: a[0] == "descendant", node: a[1].(*queryNode)}
+	}, NewMaybeParser[any](nil, axis), pattern))
+	node := NewOrParser[any](
+		NewAndParser[any](func(s string, a ...any) any {
+			n := &queryNode{rule: a[1].(string)}
+			for _, it := range a[2].([]any) {
+				if p, ok := it.(*queryPredicate); ok {
+					n.predicates = append(n.predicates, p)
+				} else {
+					n.items = append(n.items, it.(queryItem))
+				}
+			}
+			return n
+		}, lparen, ident, NewKleeneParser[any](func(s string, a ...any) any { return append([]any(nil), a...) }, item, nil), rparen),
+		NewAndParser[any](func(s string, a ...any) any { return &queryNode{anyNode: true} }, NewAtomParser[any](nil, "_", false, true)),
+		NewAndParser[any](func(s string, a ...any) any { return &queryNode{text: a[0].(string)} }, str),
+	)
+	pattern.Set(NewAndParser[any](func(s string, a ...any) any {
+		n := a[0].(*queryNode)
+		for _, c := range a[1].([]any) {
+			n.captures = append(n.captures, c.(string))
+		}
+		return n
+	}, node, NewKleeneParser[any](func(s string, a ...any) any { return append([]any(nil), a...) }, capture, nil)))
+
+	top := NewAndParser[any](nil, pattern)
+	top.SetContextCallback(func(ctx Context[any], s string, a ...any) (any, error) {
+		p, err := compileQueryPattern(a[0].(*queryNode))
+		return p, err
+	})
+	return NewManyParser[any](func(s string, a ...any) any {
+		q := &Query{}
+		for _, p := range a {
+			q.patterns = append(q.patterns, p.(queryPattern))
+		}
+		return q
+	}, top, nil)
+}
+
+func newQueryPredicate(name string, args []any) (*queryPredicate, error) {
+	p := &queryPredicate{}
+	for _, a := range args {
+		p.args = append(p.args, a.(queryArg))
+	}
+	if len(p.args) != 2 {
+		return nil, fmt.Errorf("%s expects 2 arguments, got %d", name, len(p.args))
+	}
+	switch name {
+	case "#not-eq?":
+		p.negated = true
+	case "#eq?":
+	case "#not-match?":
+		p.negated = true
+		fallthrough
+	case "#match?":
+		if p.args[1].capture {
+			return nil, errors.New(name + " expects a regexp as second argument")
+		}
+		re, err := regexp.Compile(p.args[1].value)
+		if err != nil {
+			return nil, err
+		}
+		p.regex = re
+	default:
+		return nil, errors.New("unknown predicate " + name)
+	}
+	if !p.args[0].capture {
+		return nil, errors.New(name + " expects a capture as first argument")
+	}
+	return p, nil
+}
+
+// compileQueryPattern collects the predicates of a top level pattern and
+// checks that they only refer to its captures.
+func compileQueryPattern(root *queryNode) (queryPattern, error) {
+	captures := map[string]bool{}
+	var predicates []*queryPredicate
+	var walk func(n *queryNode)
+	walk = func(n *queryNode) {
+		for _, c := range n.captures {
+			captures[c] = true
+		}
+		predicates = append(predicates, n.predicates...)
+		n.predicates = nil
+		for _, it := range n.items {
+			walk(it.node)
+		}
+	}
+	walk(root)
+	for _, p := range predicates {
+		for _, a := range p.args {
+			if a.capture && !captures[a.value] {
+				return queryPattern{}, errors.New("undefined capture @" + a.value)
+			}
+		}
+	}
+	return queryPattern{root: root, predicates: predicates}, nil
+}
+
+// Query returns the matches of q in the tree of n in preorder: for every
+// node, the patterns that match it in query order. Each pattern matches a
+// node at most once, with the first captures that satisfy the predicates.
+func (n *SyntaxNode[T]) Query(q *Query) []QueryMatch[T] {
+	var matches []QueryMatch[T]
+	var m queryMatcher[T]
+	visibleNodes(n, func(node *SyntaxNode[T]) bool {
+		for i := range q.patterns {
+			pattern := &q.patterns[i]
+			m.captures = m.captures[:0]
+			if m.match(pattern.root, node, func() bool { return m.check(pattern.predicates) }) {
+				matches = append(matches, QueryMatch[T]{Pattern: i, Node: node, Captures: append([]QueryCapture[T](nil), m.captures...)})
+			}
+		}
+		return false
+	})
+	return matches
+}
+
+// visible reports whether queries see n: named nodes and tokens are visible,
+// the combinators around them and empty matches are not.
+func (n *SyntaxNode[T]) visible() bool {
+	return n.Rule != "" || len(n.Children) == 0 && n.Span.End > n.Span.Start
+}
+
+// visibleNodes calls f for the visible nodes of the tree of n in preorder
+// until f returns true, and reports whether it did.
+func visibleNodes[T any](n *SyntaxNode[T], f func(*SyntaxNode[T]) bool) bool {
+	if n.visible() && f(n) {
+		return true
+	}
+	for _, c := range n.Children {
+		if visibleNodes(c, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleChildren appends the nearest visible nodes below n.
+func visibleChildren[T any](n *SyntaxNode[T], result []*SyntaxNode[T]) []*SyntaxNode[T] {
+	for _, c := range n.Children {
+		if c.visible() {
+			result = append(result, c)
+		} else {
+			result = visibleChildren(c, result)
+		}
+	}
+	return result
+}
+
+// queryMatcher matches patterns by backtracking. Every step gets the rest of
+// the match as continuation, so that a failure later on tries the next
+// candidate for an earlier item.
+type queryMatcher[T any] struct {
+	captures []QueryCapture[T]
+}
+
+func (m *queryMatcher[T]) match(p *queryNode, n *SyntaxNode[T], k func() bool) bool {
+	switch {
+	case p.anyNode:
+	case p.rule == "_":
+		if n.Rule == "" {
+			return false
+		}
+	case p.rule != "":
+		if n.Rule != p.rule {
+			return false
+		}
+	default:
+		if n.Text() != p.text {
+			return false
+		}
+	}
+	mark := len(m.captures)
+	for _, c := range p.captures {
+		m.captures = append(m.captures, QueryCapture[T]{Name: c, Node: n})
+	}
+	if len(p.items) == 0 && k() {
+		return true
+	}
+	if len(p.items) > 0 && m.items(p.items, n, visibleChildren(n, nil), 0, k) {
+		return true
+	}
+	m.captures = m.captures[:mark]
+	return false
+}
+
+// items matches items against the children of n from index from on.
+func (m *queryMatcher[T]) items(items []queryItem, n *SyntaxNode[T], children []*SyntaxNode[T], from int, k func() bool) bool {
+	if len(items) == 0 {
+		return k()
+	}
+	it, rest := items[0], items[1:]
+	if it.descendant {
+		// a node below the child i, the next item follows that child
+		for i := from; i < len(children); i++ {
+			if visibleNodes(children[i], func(d *SyntaxNode[T]) bool {
+				return m.match(it.node, d, func() bool { return m.items(rest, n, children, i+1, k) })
+			}) {
+				return true
+			}
+		}
+		return false
+	}
+	for i := from; i < len(children); i++ {
+		if m.match(it.node, children[i], func() bool { return m.items(rest, n, children, i+1, k) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// check evaluates predicates on the captures.
+func (m *queryMatcher[T]) check(predicates []*queryPredicate) bool {
+	for _, p := range predicates {
+		for _, left := range m.captured(p.args[0].value) {
+			var ok bool
+			if p.regex != nil {
+				ok = p.regex.MatchString(left)
+			} else if p.args[1].capture {
+				right := m.captured(p.args[1].value)
+				ok = len(right) > 0 && right[0] == left
+			} else {
+				ok = left == p.args[1].value
+			}
+			if ok == p.negated {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// captured returns the texts captured as name.
+func (m *queryMatcher[T]) captured(name string) []string {
+	var texts []string
+	for _, c := range m.captures {
+		if c.Name == name {
+			texts = append(texts, c.Node.Text())
+		}
+	}
+	return texts
+}
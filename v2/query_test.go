@@ -0,0 +1,121 @@
+package packrat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func queryTestTree(t *testing.T, input string) *SyntaxNode[any] {
+	ident := NewNamedParser[any]("ident", NewRegexParser[any](nil, `[a-z]+`, false, true))
+	null := NewNamedParser[any]("null", NewAtomParser[any](nil, "NULL", true, true))
+	num := NewNamedParser[any]("num", NewRegexParser[any](nil, `[0-9]+`, false, true))
+	value := NewOrParser[any](null, num, ident)
+	op := NewOrParser[any](NewAtomParser[any](nil, "<>", false, true), NewAtomParser[any](nil, "=", false, true), NewAtomParser[any](nil, "<", false, true))
+	cmp := NewNamedParser[any]("comparison", NewAndParser[any](nil, value, op, value))
+	call := NewNamedParser[any]("call", NewAndParser[any](nil, ident, NewAtomParser[any](nil, "(", false, true), NewManyParser[any](nil, value, NewAtomParser[any](nil, ",", false, true)), NewAtomParser[any](nil, ")", false, true)))
+	cond := NewOrParser[any](cmp, call)
+	where := NewNamedParser[any]("where", NewAndParser[any](nil, NewAtomParser[any](nil, "WHERE", true, true), NewManyParser[any](nil, cond, NewAtomParser[any](nil, "AND", true, true))))
+
+	tree, err := ParseTree[any](where, NewScanner[any](input, SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func queryResult(matches []QueryMatch[any]) string {
+	var parts []string
+	for _, m := range matches {
+		part := m.Node.Text()
+		for _, c := range m.Captures {
+			part += " @" + c.Name + "=" + c.Node.Text()
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func TestQuery(t *testing.T) {
+	tree := queryTestTree(t, "WHERE a = NULL AND NULL <> b AND f(x, NULL, 3) AND c < 2 AND d = e AND g = g")
+	cases := []struct {
+		query, expected string
+	}{
+		{`(comparison (_) "=" (null) @n)`, "a = NULL @n=NULL"},
+		{`(comparison (null))`, "a = NULL; NULL <> b"},
+		{`(comparison (null) .)`, ""},
+		{`(comparison (_) @l "=" (_) @r (#eq? @l @r))`, "g = g @l=g @r=g"},
+		{`(comparison (ident) @l (#not-eq? @l "d") (#match? @l "^[a-d]$"))`, "a = NULL @l=a; NULL <> b @l=b; c < 2 @l=c"},
+		{`(where descendant: (num) @n)`, "WHERE a = NULL AND NULL <> b AND f(x, NULL, 3) AND c < 2 AND d = e AND g = g @n=3"},
+		{`(call (ident) @f child: (null))`, "f(x, NULL, 3) @f=f"},
+		{`"<>" @op`, "<> @op=<>"},
+		{`; functions and literals
+		(call (ident) _ @first)
+		(num) @n`, "f(x, NULL, 3) @first=("},
+	}
+	for _, c := range cases {
+		q, err := CompileQuery(c.query)
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("%s should not compile", c.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if result := queryResult(tree.Query(q)); !strings.HasPrefix(result, c.expected) {
+			t.Errorf("%s: unexpected matches %q, expected %q", c.query, result, c.expected)
+		}
+	}
+}
+
+// Items behind a descendant: item match behind the child that contains its
+// node.
+func TestQueryDescendantOrder(t *testing.T) {
+	tree := queryTestTree(t, "WHERE a = NULL AND NULL <> b AND f(x, NULL, 3) AND c < 2")
+	q := MustCompileQuery(`(where descendant: (num) "AND" (comparison) @c)`)
+	if result := queryResult(tree.Query(q)); result != "WHERE a = NULL AND NULL <> b AND f(x, NULL, 3) AND c < 2 @c=c < 2" {
+		t.Errorf("unexpected matches %q", result)
+	}
+	q = MustCompileQuery(`(call descendant: (num) (null))`)
+	if result := queryResult(tree.Query(q)); result != "" {
+		t.Errorf("unexpected matches %q", result)
+	}
+	q = MustCompileQuery(`(where descendant: (null) @n (call))`)
+	if result := queryResult(tree.Query(q)); result != "WHERE a = NULL AND NULL <> b AND f(x, NULL, 3) AND c < 2 @n=NULL" {
+		t.Errorf("unexpected matches %q", result)
+	}
+}
+
+func TestQueryPatterns(t *testing.T) {
+	tree := queryTestTree(t, "WHERE f(1) AND a = 2")
+	q := MustCompileQuery(`(num) @n (comparison (ident) @id)`)
+	matches := tree.Query(q)
+	if len(matches) != 3 || matches[0].Pattern != 0 || matches[1].Pattern != 1 || matches[2].Pattern != 0 {
+		t.Fatalf("unexpected matches %q", queryResult(matches))
+	}
+	if id := matches[1].Capture("id"); id == nil || id.Text() != "a" || matches[1].Capture("n") != nil {
+		t.Errorf("unexpected captures %q", queryResult(matches[1:2]))
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, c := range []struct {
+		query, message string
+	}{
+		{`(comparison (null)`, "Parser failed"},
+		{`(comparison (null) @n (#like? @n "x"))`, "unknown predicate #like?"},
+		{`(comparison (#eq? @n "x"))`, "undefined capture @n"},
+		{`(comparison (_) @c (#match? @c "("))`, "missing closing )"},
+		{`(comparison (_) @c (#eq? @c))`, "#eq? expects 2 arguments, got 1"},
+		{`(comparison "\q")`, "invalid syntax"},
+	} {
+		_, err := CompileQuery(c.query)
+		var perr *ParserError[any]
+		if !errors.As(err, &perr) || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("%s: expected %q, got %v", c.query, c.message, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"runtime/debug"
+)
+
+// SetRecoverPanics makes Parse and ParsePartial recover panics raised while
+// parsing, e.g. by a callback or by a nil sub parser, and return them as a
+// ParserError with the rule path and the input position. The scanner has to
+// be Reset before it is used again, the parsers keep no state of the parse and
+// can be used right away. Reset does not change this setting.
+func (s *Scanner[T]) SetRecoverPanics(recoverPanics bool) {
+	s.recoverPanics = recoverPanics
+}
+
+// recoverPanic is deferred by Parse and ParsePartial.
+func (s *Scanner[T]) recoverPanic(p Parser[T], e **ParserError[T]) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	// the invocation stack still holds the rules that were running,
+	// innermost first
+	var path []string
+	for lr := s.invocationStack; lr != nil; lr = lr.next {
+		path = append(path, ParserName(lr.rule))
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	s.invocationStack = nil
+	clear(s.heads)
+	// payloads of the And, Kleene and Many matches that were interrupted
+	clear(s.args)
+	s.args = s.args[:0]
+
+	input, pos := s.errorInput(s.position)
+	line, column := s.lineIndex().lineCol(pos, ColumnBytes)
+	*e = &ParserError[T]{Parser: p, Line: line, Column: column, Position: pos, Input: input, Panic: r, RulePath: path, Stack: debug.Stack()}
+}
@@ -0,0 +1,79 @@
+package packrat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanicCallback(t *testing.T) {
+	num := NewRegexParser(func(s string) int {
+		if s == "0" {
+			panic("division by zero")
+		}
+		return 100
+	}, `[0-9]+`, false, true)
+	div := NewAndParser(func(s string, a ...int) int { return a[0] / a[2] }, num, NewAtomParser(0, "/", false, true), num)
+	expr := NewNamedParser[int]("division", div)
+
+	s := NewScanner[int]("10 /\n 0", SkipWhitespaceRegex)
+	s.SetRecoverPanics(true)
+	_, err := Parse[int](expr, s)
+	if err == nil || err.Panic != "division by zero" {
+		t.Fatalf("expected the panic, got %v", err)
+	}
+	if strings.Join(err.RulePath, " > ") != "division > And > /[0-9]+/" {
+		t.Errorf("unexpected rule path %v", err.RulePath)
+	}
+	if err.Line != 2 || err.Column != 3 || err.Position != 7 {
+		t.Errorf("unexpected position %d:%d@%d", err.Line, err.Column, err.Position)
+	}
+	if !strings.Contains(err.Error(), "division > And") || len(err.Stack) == 0 {
+		t.Errorf("unexpected error %q", err.Error())
+	}
+
+	if len(s.args) != 0 {
+		t.Errorf("payloads of the interrupted matches were kept: %v", s.args)
+	}
+
+	// the scanner can be reused after Reset
+	s.Reset("10 / 5", SkipWhitespaceRegex)
+	n, err := Parse[int](expr, s)
+	if err != nil || n.Payload != 1 {
+		t.Errorf("unexpected result %d %v", n.Payload, err)
+	}
+
+	// the parsers keep no state of the interrupted parse
+	list := NewKleeneParser(func(s string, a ...int) int { return len(a) }, expr, NewAtomParser(0, ",", false, true))
+	s.Reset("10 / 5, 10 / 0", SkipWhitespaceRegex)
+	if _, err = Parse[int](list, s); err == nil || err.Panic == nil {
+		t.Fatalf("expected the panic, got %v", err)
+	}
+	n, err = Parse[int](list, NewScanner[int]("10 / 5, 10 / 5, 10 / 5", SkipWhitespaceRegex))
+	if err != nil || n.Payload != 3 {
+		t.Errorf("unexpected result after a recovered panic %d %v", n.Payload, err)
+	}
+}
+
+func TestRecoverPanicNilParser(t *testing.T) {
+	stmt := NewNamedParser[string]("stmt", nil) // Set was never called
+	list := NewKleeneParser(func(s string, a ...string) string { return s }, stmt, NewAtomParser("", ";", false, true))
+
+	s := NewScanner[string]("a;b", SkipWhitespaceRegex)
+	s.SetRecoverPanics(true)
+	_, err := ParsePartial[string](list, s)
+	if err == nil || err.Panic == nil {
+		t.Fatalf("expected a recovered panic, got %v", err)
+	}
+	if strings.Join(err.RulePath, " > ") != "Kleene > stmt > <nil>" {
+		t.Errorf("unexpected rule path %v", err.RulePath)
+	}
+}
+
+func TestRecoverPanicDisabled(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("panics should propagate by default")
+		}
+	}()
+	Parse[string](NewNamedParser[string]("stmt", nil), NewScanner[string]("a", nil))
+}
@@ -18,6 +18,8 @@ type RegexParser[T any] struct {
 	skipWs          bool
 	caseInsensitive bool
 	rs              string
+	capture         func(groups []string, offsets []int) T
+	contextCallback func(Context[T], string) (T, error)
 }
 
 func NewRegexParser[T any](callback func(string) T, rs string, caseInsensitive bool, skipWs bool) *RegexParser[T] {
@@ -30,13 +32,40 @@ func NewRegexParser[T any](callback func(string) T, rs string, caseInsensitive b
 		prefix += "(?i)"
 	}
 	prefix += "^"
-	r := regexp.MustCompile(prefix + rs)
+	r := regexp.MustCompile(prefix + "(?:" + rs + ")")
 	return &RegexParser[T]{callback: callback, regex: r, skipWs: skipWs, caseInsensitive: caseInsensitive, rs: rs}
 }
 
+// NewRegexCaptureParser is like NewRegexParser, but callback receives the
+// submatches: groups[0] is the whole match, groups[i] the text of the i-th
+// capture group. offsets[i] is the position of groups[i] in the scanner
+// input, or -1 if the group did not participate in the match.
+//
+// Capture parsers always run the regexp engine, so only use them where the
+// groups are needed.
+func NewRegexCaptureParser[T any](callback func(groups []string, offsets []int) T, rs string, caseInsensitive bool, skipWs bool) *RegexParser[T] {
+	prefix := ""
+	if caseInsensitive {
+		prefix += "(?i)"
+	}
+	prefix += "^"
+	r := regexp.MustCompile(prefix + "(?:" + rs + ")")
+	return &RegexParser[T]{capture: callback, regex: r, skipWs: skipWs, caseInsensitive: caseInsensitive, rs: rs}
+}
+
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). It replaces the callback
+// given to the constructor.
+func (p *RegexParser[T]) SetContextCallback(callback func(Context[T], string) (T, error)) {
+	p.contextCallback = callback
+}
+
 // Regex matches only the given regexp. If skipWs is set to true, leading whitespace according to the scanner's skip regexp is skipped, but not matched by the parser.
 // Regex panics if rs is not a valid regex string.
 func (p *RegexParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
 	startPosition := s.position
 	if p.skipWs {
 		s.Skip()
@@ -62,9 +91,21 @@ func (p *RegexParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 			}
 		}
 
+		if p.contextCallback != nil {
+			ctx := s.context(s.position-matchLen, s.position)
+			v, err := p.contextCallback(ctx, matchedStr)
+			return s.callbackResult(v, err, ctx.Span, startPosition)
+		}
+		if s.deferred != nil {
+			return s.deferLeaf(p, s.position-matchLen), true
+		}
 		return Node[T]{Payload: p.callback(matchedStr)}, true
 	}
 
+	if p.capture != nil {
+		return p.matchCapture(s, startPosition)
+	}
+
 	matched := s.MatchRegexp(p.regex)
 	if matched == nil {
 		s.setPosition(startPosition)
@@ -78,5 +119,58 @@ func (p *RegexParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
 		}
 	}
 
+	if p.contextCallback != nil {
+		ctx := s.context(s.position-len(*matched), s.position)
+		v, err := p.contextCallback(ctx, *matched)
+		return s.callbackResult(v, err, ctx.Span, startPosition)
+	}
+	if s.deferred != nil {
+		return s.deferLeaf(p, s.position-len(*matched)), true
+	}
 	return Node[T]{Payload: p.callback(*matched)}, true
 }
+
+func (p *RegexParser[T]) matchCapture(s *Scanner[T], startPosition int) (Node[T], bool) {
+	loc := p.regex.FindStringSubmatchIndex(s.remainingInput)
+	if loc == nil {
+		s.setPosition(startPosition)
+		return Node[T]{}, false
+	}
+	input := s.remainingInput
+	matchPosition := s.position
+	s.move(loc[1])
+
+	if p.skipWs {
+		if !s.isAtBreak() {
+			s.setPosition(startPosition)
+			return Node[T]{}, false
+		}
+	}
+
+	if s.deferred != nil {
+		return s.deferLeaf(p, matchPosition), true
+	}
+	return Node[T]{Payload: p.captureResult(input, loc, matchPosition)}, true
+}
+
+func (p *RegexParser[T]) captureResult(input string, loc []int, matchPosition int) T {
+	groups := make([]string, len(loc)/2)
+	offsets := make([]int, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] < 0 {
+			offsets[i] = -1
+			continue
+		}
+		groups[i] = input[loc[2*i]:loc[2*i+1]]
+		offsets[i] = matchPosition + loc[2*i]
+	}
+	return p.capture(groups, offsets)
+}
+
+func (p *RegexParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	if p.capture != nil {
+		// matching the same input again yields the same groups
+		return p.captureResult(d.input, p.regex.FindStringSubmatchIndex(d.input), d.pos)
+	}
+	return p.callback(d.input[:d.n])
+}
@@ -31,3 +31,47 @@ func TestRegex(t *testing.T) {
 		t.Error("Regex combinator matches irregular input")
 	}
 }
+
+func TestRegexCapture(t *testing.T) {
+	type ref struct {
+		schema, table string
+		offsets       []int
+	}
+	tableRef := NewRegexCaptureParser(func(groups []string, offsets []int) ref {
+		return ref{groups[1], groups[2], offsets}
+	}, `(?:([a-z]+)\.)?([a-z]+)`, false, true)
+
+	n, err := Parse[ref](tableRef, NewScanner[ref]("  main.users", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload.schema != "main" || n.Payload.table != "users" {
+		t.Errorf("unexpected groups %v", n.Payload)
+	}
+	if n.Payload.offsets[0] != 2 || n.Payload.offsets[1] != 2 || n.Payload.offsets[2] != 7 {
+		t.Errorf("unexpected offsets %v", n.Payload.offsets)
+	}
+
+	n, err = Parse[ref](tableRef, NewScanner[ref]("users", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload.schema != "" || n.Payload.offsets[1] != -1 || n.Payload.table != "users" {
+		t.Errorf("unmatched group should be empty with offset -1: %v", n.Payload)
+	}
+}
+
+func TestRegexAlternation(t *testing.T) {
+	// every branch of a top-level alternation is anchored
+	for _, p := range []*RegexParser[string]{
+		NewRegexParser(func(s string) string { return s }, `a+|b[0-9]`, false, false),
+		NewRegexCaptureParser(func(groups []string, offsets []int) string { return groups[0] }, `a+|b[0-9]`, false, false),
+	} {
+		if n, err := Parse[string](p, NewScanner[string]("b1", nil)); err != nil || n.Payload != "b1" {
+			t.Errorf("expected b1, got %q %v", n.Payload, err)
+		}
+		if n, err := Parse[string](p, NewScanner[string]("cb1", nil)); err == nil {
+			t.Errorf("unanchored branch matched %q", n.Payload)
+		}
+	}
+}
@@ -9,16 +9,40 @@ package packrat
 
 type RestParser[T any] struct {
 	converter func (string) T
+	contextCallback func(Context[T], string) (T, error)
 }
 
 func NewRestParser[T any](converter func (string) T) *RestParser[T] {
 	return &RestParser[T]{converter: converter}
 }
 
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). It replaces the converter
+// given to the constructor.
+func (p *RestParser[T]) SetContextCallback(callback func(Context[T], string) (T, error)) {
+	p.contextCallback = callback
+}
+
 func (p *RestParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.onTokens(p) {
+		return Node[T]{}, false
+	}
 	// just slice away the rest
 	v := s.remainingInput
+	start := s.position
 	s.setPosition(len(s.input))
+	if p.contextCallback != nil {
+		ctx := s.context(start, s.position)
+		result, err := p.contextCallback(ctx, v)
+		return s.callbackResult(result, err, ctx.Span, start)
+	}
+	if s.deferred != nil {
+		return s.deferLeaf(p, start), true
+	}
 	return Node[T]{Payload: p.converter(v)}, true
 }
 
+
+func (p *RestParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	return p.converter(d.input[:d.n])
+}
@@ -0,0 +1,143 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrOverlappingEdits is returned by Rewriter when two edits change the same
+// part of the source.
+var ErrOverlappingEdits = errors.New("packrat: overlapping edits")
+
+// Edit replaces the source text of Span with Text. An empty span inserts
+// Text.
+type Edit struct {
+	Span Span
+	Text string
+}
+
+// Rewriter collects edits of a parsed source, e.g. for codemods that find
+// fragments with ParseTree or a Query, and applies them to the source. The
+// text between the edits, including whitespace and comments, is kept as it
+// is.
+type Rewriter[T any] struct {
+	source string
+	edits  []rewriteEdit[T]
+	check  *Scanner[T]
+}
+
+type rewriteEdit[T any] struct {
+	Edit
+	// the parser of the replaced node, nil for plain spans
+	parser Parser[T]
+}
+
+// NewRewriter returns a rewriter for source. Spans passed to it must come
+// from a parse of source.
+func NewRewriter[T any](source string) *Rewriter[T] {
+	return &Rewriter[T]{source: source}
+}
+
+// Replace replaces the text of span.
+func (r *Rewriter[T]) Replace(span Span, text string) {
+	r.edits = append(r.edits, rewriteEdit[T]{Edit: Edit{Span: span, Text: text}})
+}
+
+// ReplaceNode replaces the text of a syntax tree node. If checking is on
+// (see SetCheck), the replacement must be valid for the parser of n.
+func (r *Rewriter[T]) ReplaceNode(n *SyntaxNode[T], text string) {
+	r.edits = append(r.edits, rewriteEdit[T]{Edit: Edit{Span: n.Span, Text: text}, parser: n.Parser})
+}
+
+// Delete removes the text of span.
+func (r *Rewriter[T]) Delete(span Span) {
+	r.Replace(span, "")
+}
+
+// Insert inserts text at the byte offset pos of the source. Insertions at the
+// same offset keep their order.
+func (r *Rewriter[T]) Insert(pos int, text string) {
+	r.Replace(Span{Start: pos, End: pos, source: r.source}, text)
+}
+
+// SetCheck makes Apply re-parse every replacement of ReplaceNode with the
+// parser of the replaced node on s, which must be a scanner of a text input
+// configured like the one of the original parse. The skipper of s is kept,
+// its input is replaced. nil turns checking off.
+func (r *Rewriter[T]) SetCheck(s *Scanner[T]) {
+	r.check = s
+}
+
+// Edits returns the edits ordered by position. Insertions come before a
+// replacement at the same offset. It fails with ErrOverlappingEdits if two
+// edits share source text or an insertion is inside a replacement.
+func (r *Rewriter[T]) Edits() ([]Edit, error) {
+	if err := r.sort(); err != nil {
+		return nil, err
+	}
+	edits := make([]Edit, len(r.edits))
+	for i, e := range r.edits {
+		edits[i] = e.Edit
+	}
+	return edits, nil
+}
+
+func (r *Rewriter[T]) sort() error {
+	sort.SliceStable(r.edits, func(i, j int) bool {
+		a, b := r.edits[i].Span, r.edits[j].Span
+		return a.Start < b.Start || a.Start == b.Start && a.End == a.Start && b.End > b.Start
+	})
+	end := 0
+	for i, e := range r.edits {
+		sp := e.Span
+		if sp.source != r.source || sp.Start < 0 || sp.Start > sp.End || sp.End > len(r.source) {
+			return fmt.Errorf("packrat: edit %d-%d is not a span of the source", sp.Start, sp.End)
+		}
+		if i > 0 && sp.Start < end {
+			prev := r.edits[i-1].Span
+			return fmt.Errorf("%w: %d-%d and %d-%d", ErrOverlappingEdits, prev.Start, prev.End, sp.Start, sp.End)
+		}
+		end = max(end, sp.End)
+	}
+	return nil
+}
+
+// Apply returns the source with all edits applied. It fails if edits
+// overlap or, when checking, a replacement does not parse; the error then
+// wraps the *ParserError of the replacement.
+func (r *Rewriter[T]) Apply() (string, error) {
+	if err := r.sort(); err != nil {
+		return "", err
+	}
+	if r.check != nil {
+		for _, e := range r.edits {
+			if e.parser == nil {
+				continue
+			}
+			r.check.reset(e.Text)
+			if _, err := ParseTree(e.parser, r.check); err != nil {
+				line, column := e.Span.LineColumn()
+				return "", fmt.Errorf("packrat: replacement of %s at line %d, column %d: %w", ParserName(e.parser), line, column, err)
+			}
+		}
+	}
+
+	var b strings.Builder
+	pos := 0
+	for _, e := range r.edits {
+		b.WriteString(r.source[pos:e.Span.Start])
+		b.WriteString(e.Text)
+		pos = e.Span.End
+	}
+	b.WriteString(r.source[pos:])
+	return b.String(), nil
+}
@@ -0,0 +1,107 @@
+package packrat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// rewriteTestGrammar parses a WHERE clause with comparisons and calls
+func rewriteTestGrammar() Parser[any] {
+	ident := NewNamedParser[any]("ident", NewRegexParser[any](nil, `[a-z]+`, false, true))
+	null := NewNamedParser[any]("null", NewAtomParser[any](nil, "NULL", true, true))
+	num := NewNamedParser[any]("num", NewRegexParser[any](nil, `[0-9]+`, false, true))
+	value := NewOrParser[any](null, num, ident)
+	op := NewOrParser[any](NewAtomParser[any](nil, "=", false, true), NewAtomParser[any](nil, "<", false, true))
+	cmp := NewNamedParser[any]("comparison", NewAndParser[any](nil, value, op, value))
+	call := NewNamedParser[any]("call", NewAndParser[any](nil, ident, NewAtomParser[any](nil, "(", false, true), NewManyParser[any](nil, value, NewAtomParser[any](nil, ",", false, true)), NewAtomParser[any](nil, ")", false, true)))
+	return NewNamedParser[any]("where", NewAndParser[any](nil, NewAtomParser[any](nil, "WHERE", true, true), NewManyParser[any](nil, NewOrParser[any](cmp, call), NewAtomParser[any](nil, "AND", true, true))))
+}
+
+func rewriteTestTree(t *testing.T, s *Scanner[any]) *SyntaxNode[any] {
+	tree, err := ParseTree[any](rewriteTestGrammar(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestRewriter(t *testing.T) {
+	input := "WHERE a = NULL  AND\n  f(x, 3) AND b < 2 -- keep"
+	s := NewScanner[any](input, nil)
+	s.SetSkipper(SQLSkipper)
+	tree := rewriteTestTree(t, s)
+
+	r := NewRewriter[any](input)
+	for _, m := range tree.Query(MustCompileQuery(`(comparison (_) @l "=" (null) @n)`)) {
+		r.Replace(m.Node.Span, m.Capture("l").Text()+" IS NULL")
+	}
+	for _, m := range tree.Query(MustCompileQuery(`(num) @n`)) {
+		r.ReplaceNode(m.Node, m.Node.Text()+"0")
+	}
+	call := tree.Query(MustCompileQuery(`(call (ident) @f)`))[0]
+	r.Insert(call.Node.Span.End, " /* checked */")
+	r.Insert(call.Capture("f").Span.Start, "lib.")
+	r.Delete(call.Capture("f").Span)
+	r.Insert(call.Capture("f").Span.End, "g")
+
+	result, err := r.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "WHERE a IS NULL  AND\n  lib.g(x, 30) /* checked */ AND b < 20 -- keep"; result != expected {
+		t.Errorf("unexpected result\n%s\n%s", result, expected)
+	}
+	edits, _ := r.Edits()
+	if len(edits) != 7 || edits[0].Text != "a IS NULL" || edits[1].Text != "lib." || edits[2].Text != "" {
+		t.Errorf("unexpected edit order %v", edits)
+	}
+}
+
+func TestRewriterOverlap(t *testing.T) {
+	input := "WHERE f(1, 2)"
+	tree := rewriteTestTree(t, NewScanner[any](input, SkipWhitespaceRegex))
+	call := tree.Query(MustCompileQuery(`(call (num) @n)`))[0]
+
+	for _, edit := range []func(r *Rewriter[any]){
+		func(r *Rewriter[any]) { r.Replace(call.Capture("n").Span, "3") },
+		func(r *Rewriter[any]) { r.Insert(call.Capture("n").Span.Start+1, "3") },
+		func(r *Rewriter[any]) { r.Delete(call.Node.Span) },
+	} {
+		r := NewRewriter[any](input)
+		r.Replace(call.Node.Span, "g()")
+		edit(r)
+		if _, err := r.Apply(); !errors.Is(err, ErrOverlappingEdits) {
+			t.Errorf("expected overlapping edits, got %v", err)
+		}
+	}
+
+	r := NewRewriter[any]("WHERE f(1, 2) ")
+	r.Replace(call.Node.Span, "g()")
+	if _, err := r.Apply(); err == nil || !strings.Contains(err.Error(), "not a span of the source") {
+		t.Errorf("expected a foreign span error, got %v", err)
+	}
+}
+
+func TestRewriterCheck(t *testing.T) {
+	input := "WHERE a = 1 AND b = 2"
+	tree := rewriteTestTree(t, NewScanner[any](input, SkipWhitespaceRegex))
+	cmps := tree.Query(MustCompileQuery(`(comparison)`))
+
+	r := NewRewriter[any](input)
+	r.SetCheck(NewScanner[any]("", SkipWhitespaceRegex))
+	r.ReplaceNode(cmps[0].Node, "1 < x")
+	r.ReplaceNode(cmps[1].Node, " b = c ")
+	if result, err := r.Apply(); err != nil || result != "WHERE 1 < x AND  b = c " {
+		t.Fatalf("unexpected result %q %v", result, err)
+	}
+
+	r = NewRewriter[any](input)
+	r.SetCheck(NewScanner[any]("", SkipWhitespaceRegex))
+	r.ReplaceNode(cmps[1].Node, "b IS NULL")
+	_, err := r.Apply()
+	var perr *ParserError[any]
+	if !errors.As(err, &perr) || perr.Input != "b IS NULL" || !strings.Contains(err.Error(), "replacement of comparison at line 1, column 17") {
+		t.Errorf("expected a parse error of the replacement, got %v", err)
+	}
+}
@@ -20,6 +20,7 @@ type MemoEntry[T any] struct {
 	Ok bool
 
 	Position int
+	Start    int // position of the first token of the match, see tokenStart
 }
 
 type Head[T any] struct {
@@ -59,6 +60,11 @@ type Lr[T any] struct {
 }
 
 type Scanner[T any] struct {
+	// UserData is per-parse state of the caller, like an arena allocator or
+	// a catalog, that context callbacks can reach (see Context).
+	// Embedded scanners share it. Reset does not change it.
+	UserData any
+
 	input           string
 	remainingInput  string
 	position        int
@@ -70,21 +76,82 @@ type Scanner[T any] struct {
 	headpool        sync.Pool
 	lrPool          sync.Pool
 
-	skipRegex *regexp.Regexp
+	skipper Skipper
+	words   *WordClass
+
+	// embedded scanners (see EmbedParser) map their positions back into the
+	// parent input: either by a constant base offset or by a per-byte table
+	parent  *Scanner[T]
+	base    int
+	offsets []int
+
+	// farthest failure reported by an embedded scanner, in input coordinates
+	embedFailPos     int
+	embedFailParsers []Parser[T]
+
+	// grammar version the scanner is pinned to, 0 for the newest (see Grammar)
+	version uint64
+
+	// token-stream mode (see NewTokenScanner): positions are token indices
+	tokens []Token
+	source string
+
+	// binary input (see NewBytesScanner): every position is a word boundary
+	binary bool
+
+	// error of a callback that aborted the parse (see ErrMismatch)
+	abortErr  error
+	abortSpan Span
+
+	// see SetRecoverPanics
+	recoverPanics bool
+
+	// derivations of deferred callbacks, nil unless deferred (see
+	// SetDeferred); shared with embedded scanners
+	deferred *deferredStore[T]
+
+	// recorded matches, nil unless tracing; shared with embedded scanners
+	trace *traceStore[T]
+
+	// line starts of the input, built on demand (see LineCol)
+	lines *lineIndex
+
+	// payloads of the sub parsers of the And, Kleene and Many matches in
+	// progress, a stack so that grammars keep no per-parse state
+	args []T
+
+	// position of the first token of the rule in progress after skipped
+	// whitespace, -1 until it has matched one (see tokenStart)
+	first int
 }
 
 // Copy clones the scanner state. Memoization and break slices are shared.
 // Pools are shared by copying the New functions.
 func (s *Scanner[T]) Copy() *Scanner[T] {
 	ns := &Scanner[T]{
-		input:           s.input,
-		remainingInput:  s.remainingInput,
-		position:        s.position,
-		memoization:     s.memoization,
-		heads:           s.heads,
-		invocationStack: s.invocationStack,
-		breaks:          s.breaks,
-		skipRegex:       s.skipRegex,
+		input:            s.input,
+		remainingInput:   s.remainingInput,
+		position:         s.position,
+		memoization:      s.memoization,
+		heads:            s.heads,
+		invocationStack:  s.invocationStack,
+		breaks:           s.breaks,
+		skipper:          s.skipper,
+		words:            s.words,
+		parent:           s.parent,
+		base:             s.base,
+		offsets:          s.offsets,
+		embedFailPos:     s.embedFailPos,
+		embedFailParsers: s.embedFailParsers,
+		version:          s.version,
+		UserData:         s.UserData,
+		tokens:           s.tokens,
+		source:           s.source,
+		binary:           s.binary,
+		recoverPanics:    s.recoverPanics,
+		deferred:         s.deferred,
+		trace:            s.trace,
+		first:            s.first,
 	}
 	ns.headpool.New = s.headpool.New
 	ns.lrPool.New = s.lrPool.New
@@ -112,8 +179,15 @@ func (s *Scanner[T]) Recall(rule Parser[T], pos int) *MemoEntry[T] {
 	// Allow involved rules to be evaluated, but only once, during a seed-growing iteration
 	if head.IsEvaluated(rule) {
 		delete(head.evalSet, rule)
+		outer, mark := s.first, s.traceMark()
+		s.first = -1
 		node, ok := rule.Match(s)
-		return &MemoEntry[T]{Position: s.position, Ans: node, Ok: ok}
+		start := s.tokenStart(pos)
+		if ok && s.trace != nil {
+			node = s.traceMatch(rule, start, mark, node)
+		}
+		s.first = outer
+		return &MemoEntry[T]{Position: s.position, Ans: node, Ok: ok, Start: start}
 	}
 
 	return m
@@ -144,7 +218,13 @@ func (s *Scanner[T]) GrowLr(rule Parser[T], p int, m *MemoEntry[T], h *Head[T])
 		for k, v := range h.involvedSet {
 			h.evalSet[k] = v
 		}
+		mark := s.traceMark()
+		s.first = -1
 		ans, ok := rule.Match(s)
+		start := s.tokenStart(p)
+		if ok && s.trace != nil {
+			ans = s.traceMatch(rule, start, mark, ans)
+		}
 		if !ok || s.position <= m.Position {
 			break
 		}
@@ -152,6 +232,7 @@ func (s *Scanner[T]) GrowLr(rule Parser[T], p int, m *MemoEntry[T], h *Head[T])
 		m.Ans = ans
 		m.Ok = ok
 		m.Position = s.position
+		m.Start = start
 	}
 	s.headpool.Put(s.heads[p])
 	delete(s.heads, p)
@@ -177,7 +258,8 @@ func (s *Scanner[T]) LrAnswer(rule Parser[T], pos int, m *MemoEntry[T]) (Node[T]
 var SkipWhitespaceRegex = regexp.MustCompile("^[\r\n\t ]+")
 var SkipWhitespaceAndCommentsRegex = regexp.MustCompile("^(?:/\\*.*?\\*/|[\r\n\t ]+)+") // regex for comments
 
-// skipper: use nil, SkipWhitespaceRegex or your very own regex
+// skipper: use nil, SkipWhitespaceRegex or your very own regex. Use SetSkipper
+// for skippers that are not regular expressions.
 func NewScanner[T any](input string, skipper *regexp.Regexp) *Scanner[T] {
 	s := &Scanner[T]{input: input, position: 0,
 		memoization: make([]map[Parser[T]]*MemoEntry[T], len(input)+1),
@@ -187,20 +269,11 @@ func NewScanner[T any](input string, skipper *regexp.Regexp) *Scanner[T] {
 	}
 	s.lrPool.New = func() any { return &Lr[T]{} }
 	s.remainingInput = s.input
-	s.skipRegex = skipper
+	s.first = -1
+	s.SetRegexSkipper(skipper)
+	s.embedFailPos = -1
 	s.breaks = make([]bool, len(input)+1)
-
-	previousWord := false
-	for pos, r := range input {
-		currentWord := unicode.In(r, unicode.N, unicode.L, unicode.Pc)
-		if !currentWord || !previousWord {
-			s.breaks[pos] = true
-		}
-
-		previousWord = currentWord
-	}
-
-	s.breaks[len(input)] = true
+	s.computeBreaks()
 
 	return s
 }
@@ -208,12 +281,42 @@ func NewScanner[T any](input string, skipper *regexp.Regexp) *Scanner[T] {
 // Reset reinitializes the scanner for a new input, reusing allocated slices
 // when possible. This allows pooling Scanners across queries to avoid per-query
 // construction allocations.
+//
+// A nil skipper removes a regexp skipper, but keeps a skipper installed with
+// SetSkipper.
 func (s *Scanner[T]) Reset(input string, skipper *regexp.Regexp) {
+	s.binary = false
+	if _, ok := s.skipper.(*regexSkipper); skipper != nil || ok {
+		s.SetRegexSkipper(skipper)
+	}
+	s.reset(input)
+}
+
+func (s *Scanner[T]) reset(input string) {
 	s.input = input
 	s.position = 0
 	s.remainingInput = input
-	s.skipRegex = skipper
 	s.invocationStack = nil
+	s.embedFailPos = -1
+	s.embedFailParsers = nil
+	s.parent = nil
+	s.base = 0
+	s.offsets = nil
+	s.version = 0
+	s.tokens = nil
+	s.source = ""
+	s.abortErr = nil
+	s.abortSpan = Span{}
+	s.lines = nil
+	clear(s.args)
+	s.args = s.args[:0]
+	s.first = -1
+	if s.deferred != nil {
+		s.deferred.reset()
+	}
+	if s.trace != nil {
+		s.trace.reset()
+	}
 
 	// Clear heads map (reuse the map object)
 	clear(s.heads)
@@ -240,16 +343,35 @@ func (s *Scanner[T]) Reset(input string, skipper *regexp.Regexp) {
 		s.breaks = make([]bool, needed)
 	}
 
-	// Rebuild word breaks
-	previousWord := false
-	for pos, r := range input {
-		currentWord := unicode.In(r, unicode.N, unicode.L, unicode.Pc)
-		if !currentWord || !previousWord {
-			s.breaks[pos] = true
+	s.computeBreaks()
+}
+
+func isDefaultWordChar(r rune) bool {
+	return unicode.In(r, unicode.N, unicode.L, unicode.Pc)
+}
+
+// computeBreaks marks word boundaries according to the scanner's word class.
+// breaks must be sized len(input)+1 and cleared.
+func (s *Scanner[T]) computeBreaks() {
+	if s.binary {
+		for i := range s.breaks {
+			s.breaks[i] = true
 		}
-		previousWord = currentWord
+		return
+	}
+	words := s.words
+	if words == nil {
+		words = DefaultWordClass
 	}
-	s.breaks[len(input)] = true
+	words.markBreaks(s.input, s.breaks)
+}
+
+// SetWordClass changes which characters form words for atoms and regexes with
+// skipWs. nil restores DefaultWordClass. The word class is kept across Reset.
+func (s *Scanner[T]) SetWordClass(words *WordClass) {
+	s.words = words
+	clear(s.breaks)
+	s.computeBreaks()
 }
 
 func (s *Scanner[T]) isAtBreak() bool {
@@ -277,10 +399,106 @@ func (s *Scanner[T]) MatchRegexp(r *regexp.Regexp) *string {
 	return nil
 }
 
+// SetSkipper replaces the skipper that decides which whitespace and comments
+// are skipped in front of tokens. nil disables skipping.
+func (s *Scanner[T]) SetSkipper(skipper Skipper) {
+	s.skipper = skipper
+}
+
+// SetRegexSkipper sets a regexp anchored with ^ as skipper, see NewRegexSkipper.
+func (s *Scanner[T]) SetRegexSkipper(skipper *regexp.Regexp) {
+	if skipper == nil {
+		s.skipper = nil
+		return
+	}
+	if sk, ok := s.skipper.(*regexSkipper); ok && sk.re == skipper {
+		// Reset with the same regexp keeps the adapter
+		return
+	}
+	s.skipper = NewRegexSkipper(skipper)
+}
+
 func (s *Scanner[T]) Skip() {
-	if s.skipRegex != nil && s.position < len(s.input) &&
-		(s.input[s.position] <= ' ' || s.input[s.position] == '/') {
-		s.MatchRegexp(s.skipRegex)
+	if s.skipper != nil && s.position < len(s.input) {
+		if n := s.skipper.Skip(s.input, s.position); n > 0 {
+			s.move(n)
+		}
+	}
+	if s.first < 0 {
+		s.first = s.position
+	}
+}
+
+// tokenStart returns the position of the first token matched by the rule in
+// progress, which excludes the whitespace it skipped before, or start if it
+// has matched nothing yet. Rules that do not skip start their first token
+// right away.
+func (s *Scanner[T]) tokenStart(start int) int {
+	if s.first >= 0 && s.first <= s.position {
+		return s.first
+	}
+	return start
+}
+
+// endRule restores the first token position outer of the invoking rule after
+// a sub rule that started at pos and whose first token is at start.
+func (s *Scanner[T]) endRule(outer int, ok bool, pos, start int) {
+	s.first = outer
+	if outer < 0 && ok && s.position > pos {
+		s.first = start
+	}
+}
+
+// SourcePos maps a position of this scanner to the corresponding byte offset
+// in the outermost input. For scanners not created by an EmbedParser this is
+// the identity.
+func (s *Scanner[T]) SourcePos(pos int) int {
+	if s.tokens != nil {
+		if pos < len(s.tokens) {
+			pos = s.tokens[pos].Pos
+		} else {
+			pos = len(s.source)
+		}
+	}
+	for s.parent != nil {
+		if s.offsets != nil {
+			pos = s.offsets[pos]
+		} else {
+			pos += s.base
+		}
+		s = s.parent
+	}
+	return pos
+}
+
+// farthestFailure returns the rightmost position at which a rule was tried
+// together with the rules tried there. This is where syntax errors are
+// reported.
+func (s *Scanner[T]) farthestFailure() (int, []Parser[T]) {
+	maxPos := 0
+	var failedParsers []Parser[T]
+	for index := len(s.memoization) - 1; index >= 0; index-- {
+		m := s.memoization[index]
+		if len(m) > 0 {
+			maxPos = index
+			for k := range m {
+				failedParsers = append(failedParsers, k)
+			}
+			break
+		}
+	}
+	if s.embedFailPos > maxPos {
+		return s.embedFailPos, s.embedFailParsers
+	}
+	return maxPos, failedParsers
+}
+
+// noteEmbedFailure records a failure inside an embedded region so that error
+// messages point into the region instead of at its start.
+func (s *Scanner[T]) noteEmbedFailure(pos int, parsers []Parser[T]) {
+	if pos > s.embedFailPos {
+		s.embedFailPos = pos
+		s.embedFailParsers = parsers
 	}
 }
 
@@ -0,0 +1,207 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Skipper decides which part of the input is whitespace or comments and is
+// skipped in front of tokens. Skip returns the number of bytes to skip at pos;
+// 0 means there is nothing to skip. Skippers must be safe for concurrent use
+// since one skipper is usually shared by all scanners.
+type Skipper interface {
+	Skip(input string, pos int) int
+}
+
+// SkipperFunc adapts an ordinary function to the Skipper interface.
+type SkipperFunc func(input string, pos int) int
+
+func (f SkipperFunc) Skip(input string, pos int) int {
+	return f(input, pos)
+}
+
+// WhitespaceSkipper skips spaces, tabs, carriage returns and line feeds.
+var WhitespaceSkipper Skipper = whitespaceSkipper{}
+
+type whitespaceSkipper struct{}
+
+func (whitespaceSkipper) Skip(input string, pos int) int {
+	return skipWhitespace(input, pos)
+}
+
+func skipWhitespace(input string, pos int) int {
+	i := pos
+	for i < len(input) {
+		switch input[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i - pos
+		}
+	}
+	return i - pos
+}
+
+// SQLSkipper skips whitespace, -- line comments and /* */ block comments.
+var SQLSkipper = CombineSkippers(WhitespaceSkipper, NewLineCommentSkipper("--"), NewBlockCommentSkipper("/*", "*/", false))
+
+// MySQLSkipper additionally skips # line comments.
+var MySQLSkipper = CombineSkippers(WhitespaceSkipper, NewLineCommentSkipper("--"), NewLineCommentSkipper("#"), NewBlockCommentSkipper("/*", "*/", false))
+
+// CSkipper skips whitespace, // line comments and /* */ block comments.
+var CSkipper = CombineSkippers(WhitespaceSkipper, NewLineCommentSkipper("//"), NewBlockCommentSkipper("/*", "*/", false))
+
+// ShellSkipper skips whitespace and # line comments.
+var ShellSkipper = CombineSkippers(WhitespaceSkipper, NewLineCommentSkipper("#"))
+
+// NewLineCommentSkipper skips a comment from prefix up to and including the
+// next line feed or the end of input.
+func NewLineCommentSkipper(prefix string) Skipper {
+	return &lineCommentSkipper{prefix: prefix}
+}
+
+type lineCommentSkipper struct {
+	prefix string
+}
+
+func (sk *lineCommentSkipper) Skip(input string, pos int) int {
+	if !strings.HasPrefix(input[pos:], sk.prefix) {
+		return 0
+	}
+	end := strings.IndexByte(input[pos+len(sk.prefix):], '\n')
+	if end < 0 {
+		return len(input) - pos
+	}
+	return len(sk.prefix) + end + 1
+}
+
+// NewBlockCommentSkipper skips a comment from open to close. If nested is set,
+// comments may contain further comments, so /* a /* b */ c */ is skipped as a
+// whole. An unterminated comment is not skipped so that the parser reports an
+// error at its start.
+func NewBlockCommentSkipper(open, close string, nested bool) Skipper {
+	return &blockCommentSkipper{open: open, close: close, nested: nested}
+}
+
+type blockCommentSkipper struct {
+	open, close string
+	nested      bool
+}
+
+func (sk *blockCommentSkipper) Skip(input string, pos int) int {
+	if !strings.HasPrefix(input[pos:], sk.open) {
+		return 0
+	}
+	depth := 1
+	i := pos + len(sk.open)
+	for i < len(input) {
+		if strings.HasPrefix(input[i:], sk.close) {
+			i += len(sk.close)
+			depth--
+			if depth == 0 {
+				return i - pos
+			}
+		} else if sk.nested && strings.HasPrefix(input[i:], sk.open) {
+			i += len(sk.open)
+			depth++
+		} else {
+			i++
+		}
+	}
+	return 0
+}
+
+// CombineSkippers returns a skipper that applies the given skippers
+// repeatedly until none of them makes progress, so whitespace and comments
+// can alternate freely.
+func CombineSkippers(skippers ...Skipper) Skipper {
+	return &combinedSkipper{skippers: skippers}
+}
+
+type combinedSkipper struct {
+	skippers []Skipper
+}
+
+func (c *combinedSkipper) Skip(input string, pos int) int {
+	i := pos
+	for i < len(input) {
+		progress := false
+		for _, sk := range c.skippers {
+			if n := sk.Skip(input, i); n > 0 {
+				i += n
+				progress = true
+				if i >= len(input) {
+					break
+				}
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	return i - pos
+}
+
+// regexSkipper runs a regexp, but only at bytes the regexp can start with.
+type regexSkipper struct {
+	re         *regexp.Regexp
+	firstBytes [256]bool
+}
+
+// NewRegexSkipper adapts a regexp anchored with ^ (like SkipWhitespaceRegex)
+// to the Skipper interface.
+func NewRegexSkipper(re *regexp.Regexp) Skipper {
+	sk := &regexSkipper{re: re}
+	if regexFirstBytes(strings.TrimPrefix(re.String(), "^"), false, &sk.firstBytes) {
+		fillAllBytes(&sk.firstBytes)
+	}
+	return sk
+}
+
+func (sk *regexSkipper) Skip(input string, pos int) int {
+	if !sk.firstBytes[input[pos]] {
+		return 0
+	}
+	loc := sk.re.FindStringIndex(input[pos:])
+	if loc == nil {
+		return 0
+	}
+	return loc[1]
+}
+
+// parserSkipper uses a grammar to describe what is skipped.
+type parserSkipper[T any] struct {
+	parser Parser[T]
+	pool   sync.Pool
+}
+
+// NewParserSkipper turns any parser into a skipper: whatever p matches at a
+// position is skipped. p runs on a scanner without skipper; the scanner is
+// kept between calls on the same input, so memoization carries over.
+func NewParserSkipper[T any](p Parser[T]) Skipper {
+	return &parserSkipper[T]{parser: p}
+}
+
+func (sk *parserSkipper[T]) Skip(input string, pos int) int {
+	s, _ := sk.pool.Get().(*Scanner[T])
+	if s == nil {
+		s = NewScanner[T](input, nil)
+	} else if s.input != input {
+		s.Reset(input, nil)
+	}
+	s.setPosition(pos)
+	n := 0
+	if _, ok := s.applyRule(sk.parser); ok {
+		n = s.position - pos
+	}
+	sk.pool.Put(s)
+	return n
+}
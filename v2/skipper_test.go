@@ -0,0 +1,91 @@
+package packrat
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSkipperStyles(t *testing.T) {
+	tests := []struct {
+		name    string
+		skipper Skipper
+		input   string
+		skip    int
+	}{
+		{"whitespace", WhitespaceSkipper, " \t\r\nx", 4},
+		{"sql line comment", SQLSkipper, "-- comment\n  x", 13},
+		{"sql line comment at end", SQLSkipper, "  -- comment", 12},
+		{"sql block comment", SQLSkipper, "/* a */ -- b\nx", 13},
+		{"sql no hash comment", SQLSkipper, "# no comment", 0},
+		{"mysql hash comment", MySQLSkipper, "# comment\nx", 10},
+		{"shell comment", ShellSkipper, "  # comment\n# more\nx", 19},
+		{"c comments", CSkipper, "// a\n/* b */x", 12},
+		{"unterminated block", CSkipper, "/* open", 0},
+		{"flat block", NewBlockCommentSkipper("/*", "*/", false), "/* a /* b */ c */x", 12},
+		{"nested block", NewBlockCommentSkipper("/*", "*/", true), "/* a /* b */ c */x", 17},
+		{"nested unterminated", NewBlockCommentSkipper("/*", "*/", true), "/* a /* b */ c", 0},
+		{"regex", NewRegexSkipper(regexp.MustCompile("^(?:#[^\n]*\n?| )+")), "# c\n x", 5},
+		{"legacy regex", NewRegexSkipper(SkipWhitespaceAndCommentsRegex), "/* c */ x", 8},
+	}
+	for _, tt := range tests {
+		if n := tt.skipper.Skip(tt.input, 0); n != tt.skip {
+			t.Errorf("%s: expected to skip %d bytes, got %d", tt.name, tt.skip, n)
+		}
+	}
+}
+
+func TestParserSkipper(t *testing.T) {
+	ws := NewRegexParser(func(s string) int { return 0 }, `[ \t\r\n]+`, false, false)
+	comment := NewRegexParser(func(s string) int { return 0 }, `\(\*[^*]*\*\)`, false, false)
+	skipper := NewParserSkipper[int](NewManyParser(func(s string, a ...int) int { return 0 }, NewOrParser[int](ws, comment), nil))
+
+	input := " (* pascal *) x"
+	if n := skipper.Skip(input, 0); n != 14 {
+		t.Errorf("expected to skip 14 bytes, got %d", n)
+	}
+	if n := skipper.Skip(input, 14); n != 0 {
+		t.Errorf("expected to skip nothing in front of x, got %d", n)
+	}
+}
+
+func TestScannerSetSkipper(t *testing.T) {
+	p := NewAndParser(func(s string, a ...int) int { return a[0] + a[1] }, NewAtomParser(1, "SELECT", true, true), NewAtomParser(2, "x", false, true))
+
+	scanner := NewScanner[int]("SELECT -- all of it\n  # really\n x", nil)
+	scanner.SetSkipper(MySQLSkipper)
+	n, err := Parse(p, scanner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != 3 {
+		t.Errorf("unexpected payload %d", n.Payload)
+	}
+
+	scanner = NewScanner[int]("SELECT # really\n x", nil)
+	scanner.SetSkipper(SQLSkipper)
+	if _, err := Parse(p, scanner); err == nil {
+		t.Error("SQLSkipper should not skip # comments")
+	}
+}
+
+func TestResetKeepsSkipper(t *testing.T) {
+	p := NewAndParser(func(s string, a ...int) int { return a[0] + a[1] }, NewAtomParser(1, "SELECT", true, true), NewAtomParser(2, "x", false, true))
+
+	scanner := NewScanner[int]("", nil)
+	scanner.SetSkipper(SQLSkipper)
+	scanner.Reset("SELECT -- c\n x", nil)
+	if _, err := Parse(p, scanner); err != nil {
+		t.Errorf("Reset should keep the skipper: %v", err)
+	}
+
+	scanner.Reset("SELECT x", SkipWhitespaceRegex)
+	sk := scanner.skipper
+	scanner.Reset("SELECT  x", SkipWhitespaceRegex)
+	if scanner.skipper != sk {
+		t.Error("Reset with the same regexp should keep its adapter")
+	}
+	scanner.Reset("SELECT x", nil)
+	if _, err := Parse(p, scanner); err == nil {
+		t.Error("Reset with nil should remove a regexp skipper")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"strings"
+)
+
+// Span is the part of the source a parser matched, as byte offsets. For
+// embedded and token scanners the offsets refer to the outermost source.
+// Leading whitespace skipped by the parser is not part of the span. Line and
+// column are only computed when asked for.
+type Span struct {
+	Start, End int
+	source     string
+	lines      *lineIndex
+}
+
+// Text returns the source text of the span.
+func (sp Span) Text() string {
+	return sp.source[sp.Start:sp.End]
+}
+
+// LineColumn returns the 1-based line and byte column of the start.
+func (sp Span) LineColumn() (line, column int) {
+	return sp.lineColumn(sp.Start)
+}
+
+// EndLineColumn returns the 1-based line and byte column of the end.
+func (sp Span) EndLineColumn() (line, column int) {
+	return sp.lineColumn(sp.End)
+}
+
+// lineColumn uses the line index of the source the span comes from.
+func (sp Span) lineColumn(pos int) (line, column int) {
+	if sp.lines != nil {
+		return sp.lines.lineCol(pos, ColumnBytes)
+	}
+	return lineColumn(sp.source, pos)
+}
+
+func lineColumn(source string, pos int) (line, column int) {
+	consumed := source[:pos]
+	return strings.Count(consumed, "\n") + 1, pos - strings.LastIndexByte(consumed, '\n')
+}
+
+// span returns the span from start to end in the scanner input. Callers pass
+// the start of the first token (see tokenStart), so skipped whitespace is not
+// part of the span.
+func (s *Scanner[T]) span(start, end int) Span {
+	lines := s.lineIndex()
+	source := lines.source
+	if s.tokens != nil {
+		// the span ends after the last token, not before the next one
+		if end > start {
+			last := s.tokens[end-1]
+			return Span{Start: s.tokens[start].Pos, End: last.Pos + len(last.Text), source: source, lines: lines}
+		}
+		pos := s.SourcePos(start)
+		return Span{Start: pos, End: pos, source: source, lines: lines}
+	}
+	return Span{Start: s.SourcePos(start), End: s.SourcePos(end), source: source, lines: lines}
+}
@@ -0,0 +1,142 @@
+package packrat
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSpanCallbacks(t *testing.T) {
+	spanOf := func(ctx Context[string], s string) (string, error) {
+		sp := ctx.Span
+		line, col := sp.LineColumn()
+		return fmt.Sprintf("%q@%d-%d(%d:%d)", sp.Text(), sp.Start, sp.End, line, col), nil
+	}
+	ident := NewRegexParser(func(s string) string { return s }, `[a-z]+`, false, true)
+	ident.SetContextCallback(spanOf)
+	num := NewCharClassParser(func(s string) string { return s }, NewCharClass().Spec("0-9", false), 1, 0, true)
+	num.SetContextCallback(spanOf)
+	eq := NewAtomParser("", "=", false, true)
+	eq.SetContextCallback(spanOf)
+	assign := NewAndParser(func(s string, a ...string) string { return "" }, ident, eq, num)
+	assign.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		text, _ := spanOf(ctx, s)
+		return text + "[" + a[0] + " " + a[1] + " " + a[2] + "]", nil
+	})
+	list := NewKleeneParser(func(s string, a ...string) string { return "" }, assign, NewAtomParser("", ";", false, true))
+	list.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		sp := ctx.Span
+		endLine, endCol := sp.EndLineColumn()
+		return fmt.Sprintf("%d-%d(%d:%d) %v", sp.Start, sp.End, endLine, endCol, a), nil
+	})
+
+	n, err := Parse[string](list, NewScanner[string]("  a = 1;\n  bc=23", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `2-16(2:8) ["a = 1"@2-7(1:3)["a"@2-3(1:3) "="@4-5(1:5) "1"@6-7(1:7)] "bc=23"@11-16(2:3)["bc"@11-13(2:3) "="@13-14(2:5) "23"@14-16(2:6)]]`
+	if n.Payload != expected {
+		t.Errorf("unexpected spans\n%s\n%s", n.Payload, expected)
+	}
+
+	// the empty list has an empty span
+	n, err = Parse[string](list, NewScanner[string]("", SkipWhitespaceRegex))
+	if err != nil || n.Payload != "0-0(1:1) []" {
+		t.Errorf("unexpected result %q %v", n.Payload, err)
+	}
+}
+
+func TestSpanUnskipped(t *testing.T) {
+	// tokens that are not skipped keep their text even if it looks like
+	// whitespace or a comment
+	var spans []string
+	record := func(ctx Context[string], s string, a ...string) (string, error) {
+		spans = append(spans, fmt.Sprintf("%d-%d", ctx.Span.Start, ctx.Span.End))
+		return "", nil
+	}
+	comment := NewRegexParser(func(s string) string { return s }, `--[^\n]*`, false, false)
+	comment.SetContextCallback(func(ctx Context[string], s string) (string, error) {
+		spans = append(spans, ctx.Span.Text())
+		return "", nil
+	})
+	indent := NewRegexParser(func(s string) string { return s }, ` +`, false, false)
+	line := NewAndParser(nil, indent, NewAtomParser("", "x", false, true), comment)
+	line.SetContextCallback(record)
+	stmt := NewAndParser(nil, NewAtomParser("", ";", false, true), line)
+	stmt.SetContextCallback(record)
+
+	s := NewScanner[string]("  ;  x-- note", nil)
+	s.SetSkipper(SQLSkipper)
+	if _, err := Parse[string](stmt, s); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(spans) != "[-- note 3-13 2-13]" {
+		t.Errorf("unexpected spans %v", spans)
+	}
+
+	tree, err := ParseTree[string](stmt, NewScanner[string]("  ;  x-- note", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := tree.Children[1]; line.Span.Start != 3 || line.Children[0].Text() != "  " {
+		t.Errorf("unexpected node spans %d %q", line.Span.Start, line.Children[0].Text())
+	}
+}
+
+func TestSpanTokens(t *testing.T) {
+	source := "SELECT a,\n  b FROM t"
+	tokens, err := sqlLexer().Tokenize(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := NewManyParser(func(s string, a ...string) string { return "" }, NewTokenKindParser(func(tok Token) string { return tok.Text }, "ident"), NewTokenTextParser("", ",", false))
+	var span Span
+	columns.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		span = ctx.Span
+		return "", nil
+	})
+	p := NewAndParser(func(s string, a ...string) string { return "" }, NewTokenTextParser("", "SELECT", true), columns, NewTokenTextParser("", "FROM", true), NewTokenKindParser(func(tok Token) string { return tok.Text }, "ident"))
+	if _, perr := Parse[string](p, NewTokenScanner[string](source, tokens)); perr != nil {
+		t.Fatal(perr)
+	}
+	if span.Text() != "a,\n  b" {
+		t.Errorf("unexpected span %q", span.Text())
+	}
+	if line, col := span.EndLineColumn(); line != 2 || col != 4 {
+		t.Errorf("unexpected end %d:%d", line, col)
+	}
+}
+
+func TestSpanEmbedded(t *testing.T) {
+	var span Span
+	inner := NewRegexParser(func(s string) string { return s }, `[a-z]+`, false, true)
+	inner.SetContextCallback(func(ctx Context[string], s string) (string, error) {
+		span = ctx.Span
+		return s, nil
+	})
+	embed := NewEmbedParser[string](inner, WhitespaceSkipper)
+	embed.SetRegion(NewRegexParser(func(s string) string { return s }, `"[^"]*"`, false, true), UnquoteBackslash('"'))
+	if _, err := Parse[string](embed, NewScanner[string](`  "\tabc"`, SkipWhitespaceRegex)); err != nil {
+		t.Fatal(err)
+	}
+	if span.Start != 5 || span.End != 8 || span.Text() != "abc" {
+		t.Errorf("span should refer to the host input, got %d-%d %q", span.Start, span.End, span.Text())
+	}
+}
+
+func TestSpanNoAllocs(t *testing.T) {
+	cb := func(s string, a ...string) string { return s }
+	p := NewAndParser(cb, NewAtomParser("", "a", false, false), NewAtomParser("", "b", false, false))
+	s := NewScanner[string]("ab", nil)
+	without := testing.AllocsPerRun(100, func() {
+		s.setPosition(0)
+		p.Match(s)
+	})
+	p.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) { return s, nil })
+	with := testing.AllocsPerRun(100, func() {
+		s.setPosition(0)
+		p.Match(s)
+	})
+	if without != 0 || with != 0 {
+		t.Errorf("context callbacks should not allocate: %v without, %v with", without, with)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"strings"
+	"sync"
+)
+
+// Template is a parameterized rule like "comma list of X in parentheses".
+// Instantiate builds the rule for concrete argument parsers. Instantiating a
+// template twice with the same arguments returns the same parser object, so
+// both uses share their memoization entries.
+type Template[T any] struct {
+	name      string
+	build     func(b *TemplateBuild[T], args ...Parser[T]) Parser[T]
+	mu        sync.Mutex
+	instances templateInstances[T]
+}
+
+// templateInstances holds the instantiations keyed by their arguments, one
+// level per argument.
+type templateInstances[T any] struct {
+	inst *templateInstance[T]
+	next map[Parser[T]]*templateInstances[T]
+}
+
+type templateInstance[T any] struct {
+	parser *NamedParser[T]
+	built  chan struct{} // closed when build has returned or panicked
+	ok     bool          // build has returned
+}
+
+// TemplateBuild is passed to the build function of a template and marks the
+// rules that are in progress. build instantiates templates through it,
+// including its own one for recursive rules.
+type TemplateBuild[T any] struct {
+	parent *TemplateBuild[T]
+	inst   *templateInstance[T]
+}
+
+// NewTemplate constructs a template. build is called once per distinct
+// argument list.
+func NewTemplate[T any](name string, build func(b *TemplateBuild[T], args ...Parser[T]) Parser[T]) *Template[T] {
+	return &Template[T]{name: name, build: build}
+}
+
+// Name returns the template name.
+func (t *Template[T]) Name() string {
+	return t.name
+}
+
+// Instantiate returns the rule for the given arguments. It is named after the
+// template and its arguments, e.g. ParenList(expr). If another goroutine is
+// building the rule, Instantiate waits until it is built.
+func (t *Template[T]) Instantiate(args ...Parser[T]) *NamedParser[T] {
+	return t.instantiate(nil, args)
+}
+
+// Instantiate returns the rule of template t for the given arguments like
+// Template.Instantiate. Rules that are being built by b or the builds it was
+// called from are returned right away, also to goroutines started by build;
+// they are complete once build returns.
+func (b *TemplateBuild[T]) Instantiate(t *Template[T], args ...Parser[T]) *NamedParser[T] {
+	return t.instantiate(b, args)
+}
+
+// inProgress reports whether inst is built by b or the builds it was called
+// from.
+func (b *TemplateBuild[T]) inProgress(inst *templateInstance[T]) bool {
+	for ; b != nil; b = b.parent {
+		if b.inst == inst {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Template[T]) instantiate(b *TemplateBuild[T], args []Parser[T]) *NamedParser[T] {
+	t.mu.Lock()
+	slot := t.instances.lookup(args)
+	for slot.inst != nil {
+		inst := slot.inst
+		t.mu.Unlock()
+		if b.inProgress(inst) {
+			return inst.parser
+		}
+		<-inst.built
+		if inst.ok {
+			return inst.parser
+		}
+		// build panicked, look again
+		t.mu.Lock()
+	}
+
+	names := make([]string, len(args))
+	for i, a := range args {
+		names[i] = ParserName(a)
+	}
+	inst := &templateInstance[T]{parser: NewNamedParser[T](t.name+"("+strings.Join(names, ", ")+")", nil), built: make(chan struct{})}
+	slot.inst = inst
+	t.mu.Unlock()
+
+	defer func() {
+		if !inst.ok {
+			// the next call builds the rule again
+			t.mu.Lock()
+			slot.inst = nil
+			t.mu.Unlock()
+		}
+		close(inst.built)
+	}()
+	inst.parser.Set(t.build(&TemplateBuild[T]{parent: b, inst: inst}, args...))
+	inst.ok = true
+	return inst.parser
+}
+
+// lookup returns the entry for args, creating it if needed.
+func (c *templateInstances[T]) lookup(args []Parser[T]) *templateInstances[T] {
+	for _, a := range args {
+		next := c.next[a]
+		if next == nil {
+			if c.next == nil {
+				c.next = make(map[Parser[T]]*templateInstances[T])
+			}
+			next = &templateInstances[T]{}
+			c.next[a] = next
+		}
+		c = next
+	}
+	return c
+}
+
+// NewParenListTemplate returns the template ParenList(elem) that matches a
+// comma separated, possibly empty list of elem in parentheses. callback
+// receives the payloads of the elements.
+func NewParenListTemplate[T any](callback func(string, ...T) T) *Template[T] {
+	return NewTemplate("ParenList", func(b *TemplateBuild[T], args ...Parser[T]) Parser[T] {
+		var zero T
+		list := NewKleeneParser(callback, args[0], NewAtomParser(zero, ",", false, true))
+		return NewAndParser(func(s string, parts ...T) T {
+			return parts[1]
+		}, NewAtomParser(zero, "(", false, true), list, NewAtomParser(zero, ")", false, true))
+	})
+}
+
+// NewBracketedTemplate returns the template Bracketed(elem) that matches elem
+// between the open and close tokens and passes the payload of elem through.
+func NewBracketedTemplate[T any](open, close string) *Template[T] {
+	return NewTemplate("Bracketed", func(b *TemplateBuild[T], args ...Parser[T]) Parser[T] {
+		var zero T
+		return NewAndParser(func(s string, parts ...T) T {
+			return parts[1]
+		}, NewAtomParser(zero, open, false, true), args[0], NewAtomParser(zero, close, false, true))
+	})
+}
+
+// NewAliasTemplate returns the template Alias(elem, name) that matches elem
+// followed by an optional alias: the optional keyword (like AS) and name.
+// callback receives the payload of elem and the payload of name, or the zero
+// value if there is no alias.
+func NewAliasTemplate[T any](keyword string, callback func(string, ...T) T) *Template[T] {
+	return NewTemplate("Alias", func(b *TemplateBuild[T], args ...Parser[T]) Parser[T] {
+		var zero T
+		alias := NewAndParser(func(s string, parts ...T) T {
+			return parts[1]
+		}, NewMaybeParser(zero, NewAtomParser(zero, keyword, true, true)), args[1])
+		return NewAndParser(callback, args[0], NewMaybeParser(zero, alias))
+	})
+}
@@ -0,0 +1,152 @@
+package packrat
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateSharedInstances(t *testing.T) {
+	sum := func(s string, a ...int) int {
+		r := 0
+		for _, v := range a {
+			r += v
+		}
+		return r
+	}
+	parenList := NewParenListTemplate(sum)
+	num := NewNamedParser("num", NewRegexParser(func(s string) int { return len(s) }, `[0-9]+`, false, true))
+	ident := NewNamedParser("ident", NewRegexParser(func(s string) int { return 100 }, `[a-z]+`, false, true))
+
+	a := parenList.Instantiate(num)
+	b := parenList.Instantiate(num)
+	c := parenList.Instantiate(ident)
+	if a != b {
+		t.Error("identical instantiations should share one parser")
+	}
+	if a == c {
+		t.Error("different arguments should produce different parsers")
+	}
+	if a.Name() != "ParenList(num)" {
+		t.Errorf("unexpected rule name %q", a.Name())
+	}
+
+	n, err := Parse[int](a, NewScanner[int]("(1, 22, 333)", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != 6 {
+		t.Errorf("unexpected payload %d", n.Payload)
+	}
+	if n, err := Parse[int](c, NewScanner[int]("()", SkipWhitespaceRegex)); err != nil || n.Payload != 0 {
+		t.Error("empty list should match")
+	}
+}
+
+func TestTemplateSharedMemo(t *testing.T) {
+	count := 0
+	num := NewRegexParser(func(s string) int { count++; return 1 }, `[0-9]+`, false, true)
+	parenList := NewParenListTemplate(func(s string, a ...int) int { return len(a) })
+	// two alternatives that both start with the same instantiation
+	p := NewOrParser[int](
+		NewAndParser(func(s string, a ...int) int { return a[0] }, parenList.Instantiate(num), NewAtomParser(0, "!", false, true)),
+		NewAndParser(func(s string, a ...int) int { return a[0] }, parenList.Instantiate(num), NewAtomParser(0, "?", false, true)),
+	)
+	if _, err := Parse[int](p, NewScanner[int]("(1, 2) ?", SkipWhitespaceRegex)); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("the list should be parsed once, but elements were matched %d times", count)
+	}
+}
+
+func TestTemplateRecursive(t *testing.T) {
+	leaf := NewNamedParser("x", NewAtomParser(1, "x", false, true))
+	var nested *Template[int]
+	nested = NewTemplate("Nested", func(b *TemplateBuild[int], args ...Parser[int]) Parser[int] {
+		self := b.Instantiate(nested, args...)
+		inner := NewOrParser[int](self, args[0])
+		return NewAndParser(func(s string, a ...int) int { return a[1] + 1 }, NewAtomParser(0, "[", false, true), inner, NewAtomParser(0, "]", false, true))
+	})
+	p := nested.Instantiate(leaf)
+	n, err := Parse[int](p, NewScanner[int]("[[[x]]]", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != 4 {
+		t.Errorf("unexpected payload %d", n.Payload)
+	}
+}
+
+func TestTemplateConcurrent(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := NewTemplate("Slow", func(b *TemplateBuild[int], args ...Parser[int]) Parser[int] {
+		close(started)
+		<-release
+		return args[0]
+	})
+	leaf := NewAtomParser(1, "x", false, true)
+	go slow.Instantiate(leaf)
+	<-started
+
+	// another goroutine must not get the rule before it is built
+	result := make(chan *NamedParser[int])
+	go func() { result <- slow.Instantiate(leaf) }()
+	select {
+	case <-result:
+		t.Fatal("instantiation did not wait for the build")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if n, err := Parse[int](<-result, NewScanner[int]("x", SkipWhitespaceRegex)); err != nil || n.Payload != 1 {
+		t.Errorf("unexpected result %d %v", n.Payload, err)
+	}
+}
+
+func TestTemplateBuildGoroutine(t *testing.T) {
+	// a goroutine started by build gets the rule in progress through b
+	leaf := NewAtomParser(1, "x", false, true)
+	var list *Template[int]
+	list = NewTemplate("List", func(b *TemplateBuild[int], args ...Parser[int]) Parser[int] {
+		self := make(chan *NamedParser[int])
+		go func() { self <- b.Instantiate(list, args...) }()
+		return NewOrParser[int](NewAndParser(func(s string, a ...int) int { return a[0] + a[1] }, args[0], <-self), args[0])
+	})
+	p := list.Instantiate(leaf)
+	if n, err := Parse[int](p, NewScanner[int]("x x x", SkipWhitespaceRegex)); err != nil || n.Payload != 3 {
+		t.Errorf("unexpected result %d %v", n.Payload, err)
+	}
+	if list.Instantiate(leaf) != p {
+		t.Error("the rule should be cached")
+	}
+}
+
+func TestTemplateAlias(t *testing.T) {
+	ident := NewRegexParser(func(s string) string { return s }, `[a-z]+`, false, true)
+	alias := NewAliasTemplate("AS", func(s string, a ...string) string { return a[0] + "=" + a[1] })
+	p := alias.Instantiate(ident, ident)
+	if p.Name() != "Alias(/[a-z]+/, /[a-z]+/)" {
+		t.Errorf("unexpected rule name %q", p.Name())
+	}
+	for input, expected := range map[string]string{"tbl AS t": "tbl=t", "tbl t": "tbl=t", "tbl": "tbl="} {
+		n, err := Parse[string](p, NewScanner[string](input, SkipWhitespaceRegex))
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+		} else if n.Payload != expected {
+			t.Errorf("%q: expected %q, got %q", input, expected, n.Payload)
+		}
+	}
+}
+
+func TestTemplateInError(t *testing.T) {
+	num := NewNamedParser("num", NewRegexParser(func(s string) int { return 1 }, `[0-9]+`, false, true))
+	bracketed := NewBracketedTemplate[int]("[", "]")
+	p := NewAndParser(func(s string, a ...int) int { return 0 }, NewAtomParser(0, "a", false, true), bracketed.Instantiate(num))
+	_, err := Parse[int](p, NewScanner[int]("a (1)", SkipWhitespaceRegex))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "Bracketed(num)") {
+		t.Errorf("error should name the rule: %s", err.Error())
+	}
+}
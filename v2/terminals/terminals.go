@@ -0,0 +1,207 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+// Package terminals provides ready-made parsers for the literals most
+// grammars need: quoted strings with escape decoding, SQL strings, integers
+// and floats with overflow checks, hex, octal and binary literals and Unicode
+// identifiers. The parsers hand the decoded Go value to a converter that
+// produces the payload.
+//
+// Where the packrat package has a specialized matcher for a regular
+// expression (signed integers, floats, escaped string bodies), the parsers
+// are spelled so that it is used.
+package terminals
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	packrat "github.com/launix-de/go-packrat/v2"
+)
+
+// ErrInvalidEscape is returned by Unescape for malformed escape sequences.
+var ErrInvalidEscape = errors.New("invalid escape sequence")
+
+const (
+	intRegex    = `-?[0-9]+`
+	floatRegex  = `-?[0-9]+\.?[0-9]*(?:e-?[0-9]+)?`
+	hexRegex    = `0[xX][0-9a-fA-F]+`
+	octalRegex  = `0[oO][0-7]+`
+	binaryRegex = `0[bB][01]+`
+	identRegex  = `[\p{L}_][\p{L}\p{N}_]*`
+)
+
+// NewIntParser matches a signed decimal integer like -42. Literals that do not
+// fit into an int64 do not match.
+func NewIntParser[T any](conv func(int64) T, skipWs bool) *packrat.RegexParser[T] {
+	p := packrat.NewRegexParser[T](nil, intRegex, false, skipWs)
+	p.SetContextCallback(func(ctx packrat.Context[T], s string) (T, error) {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			var zero T
+			return zero, fmt.Errorf("%w: %v", packrat.ErrMismatch, err)
+		}
+		return conv(v), nil
+	})
+	return p
+}
+
+// NewFloatParser matches a signed decimal number with optional fraction and
+// exponent like -1.5e-3. Literals beyond the range of a float64 do not match.
+func NewFloatParser[T any](conv func(float64) T, skipWs bool) *packrat.RegexParser[T] {
+	p := packrat.NewRegexParser[T](nil, floatRegex, false, skipWs)
+	p.SetContextCallback(func(ctx packrat.Context[T], s string) (T, error) {
+		v, err := strconv.ParseFloat(s, 64)
+		if math.IsInf(v, 0) {
+			var zero T
+			return zero, fmt.Errorf("%w: %v", packrat.ErrMismatch, err)
+		}
+		return conv(v), nil
+	})
+	return p
+}
+
+// NewHexParser matches a hexadecimal literal like 0xFF.
+func NewHexParser[T any](conv func(uint64) T, skipWs bool) *packrat.RegexParser[T] {
+	return newRadixParser(conv, hexRegex, 16, skipWs)
+}
+
+// NewOctalParser matches an octal literal like 0o755.
+func NewOctalParser[T any](conv func(uint64) T, skipWs bool) *packrat.RegexParser[T] {
+	return newRadixParser(conv, octalRegex, 8, skipWs)
+}
+
+// NewBinaryParser matches a binary literal like 0b1010.
+func NewBinaryParser[T any](conv func(uint64) T, skipWs bool) *packrat.RegexParser[T] {
+	return newRadixParser(conv, binaryRegex, 2, skipWs)
+}
+
+func newRadixParser[T any](conv func(uint64) T, rs string, base int, skipWs bool) *packrat.RegexParser[T] {
+	p := packrat.NewRegexParser[T](nil, rs, false, skipWs)
+	p.SetContextCallback(func(ctx packrat.Context[T], s string) (T, error) {
+		v, err := strconv.ParseUint(s[2:], base, 64)
+		if err != nil {
+			var zero T
+			return zero, fmt.Errorf("%w: %v", packrat.ErrMismatch, err)
+		}
+		return conv(v), nil
+	})
+	return p
+}
+
+// NewIdentifierParser matches a Unicode identifier: a letter or underscore
+// followed by letters, digits and underscores.
+func NewIdentifierParser[T any](conv func(string) T, skipWs bool) *packrat.RegexParser[T] {
+	return packrat.NewRegexParser(conv, identRegex, false, skipWs)
+}
+
+// NewQuotedStringParser matches a string enclosed in quote characters with
+// backslash escapes, as in C, JSON or JavaScript, and passes the decoded
+// content to conv. Strings with invalid escapes do not match. See Unescape
+// for the supported escapes.
+func NewQuotedStringParser[T any](quote byte, conv func(string) T, skipWs bool) *packrat.AndParser[T] {
+	var zero T
+	q := string(quote)
+	body := packrat.NewRegexParser[T](nil, `(\\.|[^\\`+regexp.QuoteMeta(q)+`])*`, false, false)
+	body.SetContextCallback(func(ctx packrat.Context[T], s string) (T, error) {
+		v, err := Unescape(s)
+		if err != nil {
+			var zero T
+			return zero, fmt.Errorf("%w: %v", packrat.ErrMismatch, err)
+		}
+		return conv(v), nil
+	})
+	return packrat.NewAndParser(func(s string, parts ...T) T {
+		return parts[1]
+	}, packrat.NewAtomParser(zero, q, false, skipWs), body, packrat.NewAtomParser(zero, q, false, false))
+}
+
+// NewSQLStringParser matches a string enclosed in quote characters where a
+// quote character inside the string is written twice, as in SQL, and passes
+// the decoded content to conv.
+func NewSQLStringParser[T any](quote byte, conv func(string) T, skipWs bool) *packrat.AndParser[T] {
+	var zero T
+	q := string(quote)
+	body := packrat.NewRegexParser(func(s string) T {
+		return conv(strings.ReplaceAll(s, q+q, q))
+	}, `(?:[^`+regexp.QuoteMeta(q)+`]|`+regexp.QuoteMeta(q+q)+`)*`, false, false)
+	return packrat.NewAndParser(func(s string, parts ...T) T {
+		return parts[1]
+	}, packrat.NewAtomParser(zero, q, false, skipWs), body, packrat.NewAtomParser(zero, q, false, false))
+}
+
+// Unescape decodes the backslash escapes \n, \r, \t, \b, \f, \v, \0, \xHH,
+// \uHHHH and \UHHHHHHHH. Any other escaped character stands for itself, so
+// \\, \" and \/ work as expected.
+func Unescape(body string) (string, error) {
+	i := strings.IndexByte(body, '\\')
+	if i < 0 {
+		return body, nil
+	}
+	result := make([]byte, 0, len(body))
+	result = append(result, body[:i]...)
+	for i < len(body) {
+		c := body[i]
+		if c != '\\' {
+			result = append(result, c)
+			i++
+			continue
+		}
+		if i+1 >= len(body) {
+			return "", ErrInvalidEscape
+		}
+		e := body[i+1]
+		i += 2
+		switch e {
+		case 'n':
+			result = append(result, '\n')
+		case 'r':
+			result = append(result, '\r')
+		case 't':
+			result = append(result, '\t')
+		case 'b':
+			result = append(result, '\b')
+		case 'f':
+			result = append(result, '\f')
+		case 'v':
+			result = append(result, '\v')
+		case '0':
+			result = append(result, 0)
+		case 'x', 'u', 'U':
+			digits := 2
+			if e == 'u' {
+				digits = 4
+			} else if e == 'U' {
+				digits = 8
+			}
+			if i+digits > len(body) {
+				return "", ErrInvalidEscape
+			}
+			v, err := strconv.ParseUint(body[i:i+digits], 16, 32)
+			if err != nil {
+				return "", ErrInvalidEscape
+			}
+			i += digits
+			if e == 'x' {
+				result = append(result, byte(v))
+			} else {
+				if !utf8.ValidRune(rune(v)) {
+					return "", ErrInvalidEscape
+				}
+				result = utf8.AppendRune(result, rune(v))
+			}
+		default:
+			result = append(result, e)
+		}
+	}
+	return string(result), nil
+}
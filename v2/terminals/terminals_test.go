@@ -0,0 +1,120 @@
+package terminals
+
+import (
+	"testing"
+
+	packrat "github.com/launix-de/go-packrat/v2"
+)
+
+func parse[T any](p packrat.Parser[T], input string) (T, bool) {
+	scanner := packrat.NewScanner[T](input, packrat.SkipWhitespaceRegex)
+	n, err := packrat.Parse(p, scanner)
+	return n.Payload, err == nil
+}
+
+func TestInt(t *testing.T) {
+	p := NewIntParser(func(v int64) any { return v }, true)
+	if v, ok := parse[any](p, " -42"); !ok || v != int64(-42) {
+		t.Errorf("expected -42, got %v", v)
+	}
+	if v, ok := parse[any](p, "9223372036854775807"); !ok || v != int64(9223372036854775807) {
+		t.Errorf("expected max int64, got %v", v)
+	}
+	if _, ok := parse[any](p, "9223372036854775808"); ok {
+		t.Error("int64 overflow should not match")
+	}
+
+	// overflowing integers fall back to the next alternative, also when
+	// parsing deferred
+	num := packrat.NewOrParser[any](p, NewFloatParser(func(v float64) any { return v }, true))
+	for _, deferred := range []bool{false, true} {
+		scanner := packrat.NewScanner[any]("9223372036854775808", packrat.SkipWhitespaceRegex)
+		scanner.SetDeferred(deferred)
+		if n, err := packrat.Parse[any](num, scanner); err != nil || n.Payload != float64(9223372036854775808) {
+			t.Errorf("deferred %v: expected a float, got %v %v", deferred, n.Payload, err)
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	p := NewFloatParser(func(v float64) any { return v }, true)
+	for input, expected := range map[string]float64{"1.5": 1.5, "-2": -2, "3e-2": 0.03, "1.e2": 100} {
+		if v, ok := parse[any](p, input); !ok || v != expected {
+			t.Errorf("%q: expected %v, got %v", input, expected, v)
+		}
+	}
+	if _, ok := parse[any](p, "1e999"); ok {
+		t.Error("float overflow should not match")
+	}
+}
+
+func TestRadix(t *testing.T) {
+	conv := func(v uint64) any { return v }
+	num := packrat.NewOrParser[any](NewHexParser(conv, true), NewOctalParser(conv, true), NewBinaryParser(conv, true), NewIntParser(func(v int64) any { return uint64(v) }, true))
+	for input, expected := range map[string]uint64{"0xFF": 255, "0X1a": 26, "0o755": 493, "0b1010": 10, "7": 7, "0xFFFFFFFFFFFFFFFF": 1<<64 - 1} {
+		if v, ok := parse[any](num, input); !ok || v != expected {
+			t.Errorf("%q: expected %v, got %v", input, expected, v)
+		}
+	}
+	if _, ok := parse[any](num, "0x10000000000000000"); ok {
+		t.Error("hex overflow should not match")
+	}
+	if _, ok := parse[any](num, "0o8"); ok {
+		t.Error("8 is no octal digit")
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	p := NewIdentifierParser(func(s string) string { return s }, true)
+	for _, input := range []string{"foo", "_bar1", "größe", "名前"} {
+		if v, ok := parse[string](p, input); !ok || v != input {
+			t.Errorf("%q should be an identifier, got %q", input, v)
+		}
+	}
+	if _, ok := parse[string](p, "1abc"); ok {
+		t.Error("identifiers must not start with a digit")
+	}
+}
+
+func TestQuotedString(t *testing.T) {
+	p := NewQuotedStringParser('"', func(s string) string { return s }, true)
+	tests := map[string]string{
+		`""`:                 "",
+		` "plain"`:           "plain",
+		`"a\"b"`:             `a"b`,
+		`"tab\there"`:        "tab\there",
+		`"ü\x41\\"`:          `üA\`,
+		`"\U0001F600 smile"`: "😀 smile",
+	}
+	for input, expected := range tests {
+		if v, ok := parse[string](p, input); !ok || v != expected {
+			t.Errorf("%s: expected %q, got %q", input, expected, v)
+		}
+	}
+	for _, input := range []string{`"\u00"`, `"open`, `"\uD800"`} {
+		if _, ok := parse[string](p, input); ok {
+			t.Errorf("%s should not match", input)
+		}
+	}
+}
+
+func TestSQLString(t *testing.T) {
+	p := NewSQLStringParser('\'', func(s string) string { return s }, true)
+	for input, expected := range map[string]string{`''`: "", `'it''s'`: "it's", `'a\b'`: `a\b`, `''''`: "'"} {
+		if v, ok := parse[string](p, input); !ok || v != expected {
+			t.Errorf("%s: expected %q, got %q", input, expected, v)
+		}
+	}
+	if _, ok := parse[string](p, `'open`); ok {
+		t.Error("unterminated string should not match")
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	if _, err := Unescape(`trailing\`); err != ErrInvalidEscape {
+		t.Error("trailing backslash should be invalid")
+	}
+	if v, err := Unescape(`a\/b`); err != nil || v != "a/b" {
+		t.Errorf("unexpected result %q, %v", v, err)
+	}
+}
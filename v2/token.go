@@ -0,0 +1,268 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Token is a lexeme produced by a Lexer. Pos is the byte offset of Text in
+// the source.
+type Token struct {
+	Kind string
+	Text string
+	Pos  int
+}
+
+type lexRule struct {
+	kind            string
+	atom            string
+	caseInsensitive bool
+	regex           *regexp.Regexp
+}
+
+// match returns the length of the match at pos or -1.
+func (r *lexRule) match(input string, pos int) int {
+	if r.regex != nil {
+		loc := r.regex.FindStringIndex(input[pos:])
+		if loc == nil {
+			return -1
+		}
+		return loc[1]
+	}
+	if len(input)-pos < len(r.atom) {
+		return -1
+	}
+	if r.caseInsensitive {
+		if !strings.EqualFold(input[pos:pos+len(r.atom)], r.atom) {
+			return -1
+		}
+	} else if input[pos:pos+len(r.atom)] != r.atom {
+		return -1
+	}
+	return len(r.atom)
+}
+
+// Lexer splits a source text into tokens for the token-stream parsing mode
+// (see NewTokenScanner). At every position it skips whitespace with its
+// skipper and then takes the longest match of all rules. Of two rules that
+// match the same length, the one added first wins, so keywords have to be
+// added before the identifier rule.
+type Lexer struct {
+	rules   []lexRule
+	skipper Skipper
+	charMap [256][]int
+}
+
+// NewLexer constructs an empty lexer. skipper may be nil.
+func NewLexer(skipper Skipper) *Lexer {
+	return &Lexer{skipper: skipper}
+}
+
+// AddAtom adds a rule for the fixed text str.
+func (l *Lexer) AddAtom(kind string, str string, caseInsensitive bool) {
+	if str == "" {
+		panic("packrat: lexer atoms must not be empty")
+	}
+	var bytes [256]bool
+	b := str[0]
+	bytes[b] = true
+	if caseInsensitive {
+		if b >= 'a' && b <= 'z' {
+			bytes[b-32] = true
+		} else if b >= 'A' && b <= 'Z' {
+			bytes[b+32] = true
+		} else if b >= 0x80 {
+			fillAllBytes(&bytes)
+		}
+	}
+	l.add(lexRule{kind: kind, atom: str, caseInsensitive: caseInsensitive}, &bytes)
+}
+
+// AddRegex adds a rule for the regular expression rs. Empty matches are
+// ignored.
+func (l *Lexer) AddRegex(kind string, rs string, caseInsensitive bool) {
+	prefix := "^"
+	if caseInsensitive {
+		prefix = "(?i)^"
+	}
+	var bytes [256]bool
+	regexFirstBytes(rs, caseInsensitive, &bytes)
+	l.add(lexRule{kind: kind, regex: regexp.MustCompile(prefix + "(?:" + rs + ")"), caseInsensitive: caseInsensitive}, &bytes)
+}
+
+func (l *Lexer) add(r lexRule, bytes *[256]bool) {
+	idx := len(l.rules)
+	l.rules = append(l.rules, r)
+	for b := range bytes {
+		if bytes[b] {
+			l.charMap[b] = append(l.charMap[b], idx)
+		}
+	}
+}
+
+// LexError reports input that no lexer rule matches.
+type LexError struct {
+	Line     int
+	Column   int
+	Position int
+	Input    string
+}
+
+func (e *LexError) Error() string {
+	endpos := min(e.Position+10, len(e.Input))
+	return fmt.Sprintf("Lexer failed at line %d, column %d (position %d of input string): unexpected %s", e.Line, e.Column, e.Position+1, strconv.Quote(e.Input[e.Position:endpos]))
+}
+
+// Tokenize splits input into tokens.
+func (l *Lexer) Tokenize(input string) ([]Token, error) {
+	var tokens []Token
+	pos := 0
+	for {
+		if l.skipper != nil && pos < len(input) {
+			pos += l.skipper.Skip(input, pos)
+		}
+		if pos >= len(input) {
+			return tokens, nil
+		}
+		best, bestLen := -1, 0
+		for _, idx := range l.charMap[input[pos]] {
+			if n := l.rules[idx].match(input, pos); n > bestLen {
+				best, bestLen = idx, n
+			}
+		}
+		if best < 0 {
+			consumed := input[:pos]
+			line := strings.Count(consumed, "\n") + 1
+			column := pos - strings.LastIndex(consumed, "\n")
+			return tokens, &LexError{Line: line, Column: column, Position: pos, Input: input}
+		}
+		tokens = append(tokens, Token{Kind: l.rules[best].kind, Text: input[pos : pos+bestLen], Pos: pos})
+		pos += bestLen
+	}
+}
+
+// TokenParser matches a single token of a token scanner (see
+// NewTokenScanner), either by kind or by text.
+type TokenParser[T any] struct {
+	kind            string
+	text            string
+	byText          bool
+	caseInsensitive bool
+	callback        func(Token) T
+	contextCallback func(Context[T], Token) (T, error)
+}
+
+// NewTokenKindParser matches a token of the given kind and passes it to
+// callback.
+func NewTokenKindParser[T any](callback func(Token) T, kind string) *TokenParser[T] {
+	return &TokenParser[T]{kind: kind, callback: callback}
+}
+
+// NewTokenTextParser matches a token with the given text regardless of its
+// kind, e.g. a keyword or an operator.
+func NewTokenTextParser[T any](value T, text string, caseInsensitive bool) *TokenParser[T] {
+	return &TokenParser[T]{text: text, byText: true, caseInsensitive: caseInsensitive, callback: func(Token) T { return value }}
+}
+
+// SetContextCallback installs a callback that additionally receives the
+// context of the match and can fail (see Context). It replaces the callback
+// or value given to the constructor.
+func (p *TokenParser[T]) SetContextCallback(callback func(Context[T], Token) (T, error)) {
+	p.contextCallback = callback
+}
+
+func (p *TokenParser[T]) String() string {
+	if p.byText {
+		return strconv.Quote(p.text)
+	}
+	return "<" + p.kind + ">"
+}
+
+// Match matches the token at the current token index.
+func (p *TokenParser[T]) Match(s *Scanner[T]) (Node[T], bool) {
+	if s.position >= len(s.tokens) {
+		return Node[T]{}, false
+	}
+	tok := s.tokens[s.position]
+	if p.byText {
+		if p.caseInsensitive {
+			if !strings.EqualFold(tok.Text, p.text) {
+				return Node[T]{}, false
+			}
+		} else if tok.Text != p.text {
+			return Node[T]{}, false
+		}
+	} else if tok.Kind != p.kind {
+		return Node[T]{}, false
+	}
+	s.move(1)
+	if p.contextCallback != nil {
+		ctx := s.context(s.position-1, s.position)
+		v, err := p.contextCallback(ctx, tok)
+		return s.callbackResult(v, err, ctx.Span, s.position-1)
+	}
+	if s.deferred != nil && !p.byText {
+		return s.deferMatch(p, tok.Text, len(tok.Text), tok.Pos, len(s.deferred.stack)), true
+	}
+	return Node[T]{Payload: p.callback(tok)}, true
+}
+
+func (p *TokenParser[T]) build(s *Scanner[T], d *derivation[T], args []T) T {
+	return p.callback(Token{Kind: p.kind, Text: d.input, Pos: d.pos})
+}
+
+// ErrTextParser is the error of a parse on a token scanner that reached a
+// parser of characters or bytes, like AtomParser or RegexParser.
+var ErrTextParser = errors.New("packrat: text parser on a token scanner")
+
+// onTokens aborts the parse with ErrTextParser if s is a token scanner. Text
+// parsers call it first, since the input of a token scanner is not the
+// source text.
+func (s *Scanner[T]) onTokens(p Parser[T]) bool {
+	if s.tokens == nil {
+		return false
+	}
+	s.abort(fmt.Errorf("%w: %v", ErrTextParser, p), s.span(s.position, s.position))
+	return true
+}
+
+// NewTokenScanner constructs a scanner over a token stream produced by a
+// Lexer. Positions of the scanner are token indices, so memoization costs one
+// slot per token instead of one per byte. Parse errors are reported at the
+// line and column of the token in source.
+//
+// Grammars for token scanners consist of TokenParsers and the combinators.
+// Parsers of characters or bytes like AtomParser and RegexParser abort the
+// parse with ErrTextParser.
+func NewTokenScanner[T any](source string, tokens []Token) *Scanner[T] {
+	s := NewScanner[T]("", nil)
+	s.ResetTokens(source, tokens)
+	return s
+}
+
+// ResetTokens reinitializes the scanner for a new token stream like Reset.
+func (s *Scanner[T]) ResetTokens(source string, tokens []Token) {
+	// the scanner input holds the first byte of each token, so that the char
+	// maps of OrParsers dispatch on tokens as well
+	first := make([]byte, len(tokens))
+	for i, tok := range tokens {
+		if len(tok.Text) > 0 {
+			first[i] = tok.Text[0]
+		}
+	}
+	s.binary = false
+	s.skipper = nil
+	s.reset(string(first))
+	s.tokens = tokens
+	s.source = source
+}
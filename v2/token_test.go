@@ -0,0 +1,119 @@
+package packrat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func sqlLexer() *Lexer {
+	l := NewLexer(SQLSkipper)
+	l.AddAtom("keyword", "SELECT", true)
+	l.AddAtom("keyword", "FROM", true)
+	l.AddRegex("ident", `[a-zA-Z_][a-zA-Z0-9_]*`, false)
+	l.AddRegex("number", `[0-9]+`, false)
+	l.AddAtom("op", "<", false)
+	l.AddAtom("op", "<=", false)
+	l.AddAtom("op", ",", false)
+	return l
+}
+
+func TestLexer(t *testing.T) {
+	tokens, err := sqlLexer().Tokenize("select a, selection -- comment\nFROM t <= 12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.Kind+":"+tok.Text+"@"+strconv.Itoa(tok.Pos))
+	}
+	expected := "keyword:select@0 ident:a@7 op:,@8 ident:selection@10 keyword:FROM@31 ident:t@36 op:<=@38 number:12@41"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("unexpected tokens %v", got)
+	}
+
+	_, err = sqlLexer().Tokenize("select a\n  from #")
+	lexErr, ok := err.(*LexError)
+	if !ok {
+		t.Fatalf("expected a lexer error, got %v", err)
+	}
+	if lexErr.Line != 2 || lexErr.Column != 8 || lexErr.Position != 16 {
+		t.Errorf("unexpected error position %d:%d (%d)", lexErr.Line, lexErr.Column, lexErr.Position)
+	}
+}
+
+func tokenGrammar() Parser[string] {
+	ident := NewTokenKindParser(func(tok Token) string { return tok.Text }, "ident")
+	number := NewTokenKindParser(func(tok Token) string { return "#" + tok.Text }, "number")
+	column := NewOrParser[string](ident, number)
+	columns := NewManyParser(func(s string, a ...string) string { return strings.Join(a, "|") }, column, NewTokenTextParser("", ",", false))
+	return NewAndParser(func(s string, a ...string) string {
+		return a[1] + " from " + a[3]
+	}, NewTokenTextParser("", "select", true), columns, NewTokenTextParser("", "from", true), ident)
+}
+
+func TestTokenScanner(t *testing.T) {
+	source := "SELECT a, 1, b FROM tbl"
+	tokens, err := sqlLexer().Tokenize(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewTokenScanner[string](source, tokens)
+	if len(s.memoization) != len(tokens)+1 {
+		t.Errorf("memoization should be per token, got %d slots", len(s.memoization))
+	}
+	n, perr := Parse(tokenGrammar(), s)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	if n.Payload != "a|#1|b from tbl" {
+		t.Errorf("unexpected payload %q", n.Payload)
+	}
+}
+
+func TestTokenScannerError(t *testing.T) {
+	source := "SELECT a,\n  b FROM 12"
+	tokens, err := sqlLexer().Tokenize(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, perr := Parse(tokenGrammar(), NewTokenScanner[string](source, tokens))
+	if perr == nil {
+		t.Fatal("expected an error")
+	}
+	if perr.Position != strings.Index(source, "12") || perr.Line != 2 {
+		t.Errorf("error should point at the token in source, got line %d position %d", perr.Line, perr.Position)
+	}
+	if !strings.Contains(perr.Error(), "<ident>") {
+		t.Errorf("error should list the expected token: %s", perr.Error())
+	}
+
+	// missing tokens at the end are reported at the end of the source
+	source = "SELECT a FROM"
+	tokens, _ = sqlLexer().Tokenize(source)
+	_, perr = Parse(tokenGrammar(), NewTokenScanner[string](source, tokens))
+	if perr == nil || perr.Position != len(source) {
+		t.Errorf("expected an error at the end of input, got %v", perr)
+	}
+}
+
+func TestTokenScannerTextParser(t *testing.T) {
+	source := "SELECT a FROM tbl"
+	tokens, _ := sqlLexer().Tokenize(source)
+	for _, p := range []Parser[string]{
+		NewAtomParser("", "S", false, false),
+		NewRegexParser(func(s string) string { return s }, `[A-Z]+`, false, false),
+		NewAndParser(nil, NewTokenTextParser("", "select", true), NewRestParser(func(s string) string { return s })),
+	} {
+		_, perr := Parse(p, NewTokenScanner[string](source, tokens))
+		if perr == nil || !errors.Is(perr.Err, ErrTextParser) {
+			t.Errorf("%v: expected ErrTextParser, got %v", p, perr)
+		}
+	}
+	// an alternative of tokens does not hide the text parser
+	p := NewOrParser[string](NewAtomParser("", "SELECT", false, false), tokenGrammar())
+	if _, perr := Parse(p, NewTokenScanner[string](source, tokens)); perr == nil || !errors.Is(perr.Err, ErrTextParser) || perr.Position != 0 {
+		t.Errorf("expected ErrTextParser at the first token, got %v", perr)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+// While tracing, every rule invocation that matches records a trace node with
+// the rule, its span and the trace nodes of the rules it invoked. Results of
+// rules that are thrown away by backtracking are dropped from the children
+// again, so the trace of the node a parse returns is exactly its derivation.
+
+// traceNode is a recorded match.
+type traceNode[T any] struct {
+	rule         Parser[T]
+	span         Span
+	first, count int32 // children in traceStore.children
+}
+
+// traceStore holds the trace nodes of a scanner and its embedded scanners.
+type traceStore[T any] struct {
+	nodes    []traceNode[T]
+	children []int32
+	stack    []int32 // children of the rule invocations in progress
+}
+
+func (st *traceStore[T]) reset() {
+	clear(st.nodes)
+	st.nodes = st.nodes[:0]
+	st.children = st.children[:0]
+	st.stack = st.stack[:0]
+}
+
+// node returns the trace node with the given id.
+func (st *traceStore[T]) node(id int32) *traceNode[T] {
+	return &st.nodes[id-1]
+}
+
+// childIDs returns the children of the trace node with the given id.
+func (st *traceStore[T]) childIDs(id int32) []int32 {
+	n := &st.nodes[id-1]
+	return st.children[n.first : n.first+n.count]
+}
+
+// traceMark returns the current height of the trace stack.
+func (s *Scanner[T]) traceMark() int {
+	if s.trace == nil {
+		return 0
+	}
+	return len(s.trace.stack)
+}
+
+// traceDrop discards the children recorded since mark.
+func (s *Scanner[T]) traceDrop(mark int) {
+	if s.trace != nil {
+		s.trace.stack = s.trace.stack[:mark]
+	}
+}
+
+// traceKeep ends a rule invocation that started at mark: only the returned
+// node remains as a child of the invoking rule.
+func (s *Scanner[T]) traceKeep(mark int, n Node[T], ok bool) {
+	st := s.trace
+	st.stack = st.stack[:mark]
+	if ok && n.trace != 0 {
+		st.stack = append(st.stack, n.trace)
+	}
+}
+
+// traceMatch records a match of rule from start to the current position
+// whose children were recorded since mark.
+func (s *Scanner[T]) traceMatch(rule Parser[T], start, mark int, n Node[T]) Node[T] {
+	st := s.trace
+	first := len(st.children)
+	st.children = append(st.children, st.stack[mark:]...)
+	st.stack = st.stack[:mark]
+	st.nodes = append(st.nodes, traceNode[T]{rule: rule, span: s.span(start, s.position), first: int32(first), count: int32(len(st.children) - first)})
+	n.trace = int32(len(st.nodes))
+	return n
+}
@@ -0,0 +1,136 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SyntaxNode is a node of the concrete syntax tree returned by ParseTree.
+type SyntaxNode[T any] struct {
+	// Parser produced the node; Rule is its name if it is a NamedParser
+	Parser   Parser[T]
+	Rule     string
+	Span     Span
+	Children []*SyntaxNode[T]
+
+	// Leading and Trailing hold the input around a token that is not part
+	// of any token, see ParseTreeTrivia
+	Leading, Trailing []Trivia
+}
+
+// Text returns the matched source text.
+func (n *SyntaxNode[T]) Text() string {
+	return n.Span.Text()
+}
+
+// String formats the tree for debugging: leaves as name and quoted text,
+// inner nodes as name and children in parentheses. The name is the rule name
+// or ParserName.
+func (n *SyntaxNode[T]) String() string {
+	var b strings.Builder
+	n.format(&b)
+	return b.String()
+}
+
+func (n *SyntaxNode[T]) format(b *strings.Builder) {
+	if n.Rule != "" {
+		b.WriteString(n.Rule)
+	} else {
+		b.WriteString(ParserName(n.Parser))
+	}
+	if len(n.Children) == 0 {
+		b.WriteString(" " + strconv.Quote(n.Text()))
+		return
+	}
+	b.WriteByte('(')
+	for i, c := range n.Children {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		c.format(b)
+	}
+	b.WriteByte(')')
+}
+
+// ParseTree parses the whole input like Parse, but returns the concrete
+// syntax tree instead of a payload: a node for every parser that took part
+// in the match, with the matched span and the nodes of its sub parsers. No
+// callbacks run apart from the ones of length fields (see
+// LengthPrefixedParser), so grammars for tooling can pass nil callbacks.
+//
+// s must be new or Reset, and it has to be Reset before it is used again.
+func ParseTree[T any](p Parser[T], s *Scanner[T]) (tree *SyntaxNode[T], err *ParserError[T]) {
+	deferred, trace := s.deferred, s.trace
+	s.deferred, s.trace = &deferredStore[T]{}, &traceStore[T]{}
+	defer func() {
+		s.deferred, s.trace = deferred, trace
+	}()
+	if s.recoverPanics {
+		defer s.recoverPanic(p, &err)
+	}
+
+	node, ok := s.applyRule(p)
+	if s.abortErr != nil {
+		return nil, s.abortError(p)
+	}
+	if !ok {
+		return nil, s.failureError(p)
+	}
+	s.Skip()
+	if len(s.remainingInput) > 0 {
+		return nil, s.trailingError(p)
+	}
+	return s.trace.tree(node.trace), nil
+}
+
+// tree builds the syntax tree of trace node root.
+func (st *traceStore[T]) tree(root int32) *SyntaxNode[T] {
+	if root == 0 {
+		return nil
+	}
+	n := st.size(root)
+	b := treeBuilder[T]{st: st, nodes: make([]SyntaxNode[T], 0, n), children: make([]*SyntaxNode[T], 0, n-1)}
+	return b.build(root)
+}
+
+// size counts the trace nodes of the tree of id.
+func (st *traceStore[T]) size(id int32) int {
+	n := 1
+	for _, c := range st.childIDs(id) {
+		n += st.size(c)
+	}
+	return n
+}
+
+// treeBuilder allocates all nodes and child lists of a tree at once.
+type treeBuilder[T any] struct {
+	st       *traceStore[T]
+	nodes    []SyntaxNode[T]
+	children []*SyntaxNode[T]
+}
+
+func (b *treeBuilder[T]) build(id int32) *SyntaxNode[T] {
+	tn := b.st.node(id)
+	b.nodes = append(b.nodes, SyntaxNode[T]{Parser: tn.rule, Span: tn.span})
+	n := &b.nodes[len(b.nodes)-1]
+	if named, ok := tn.rule.(*NamedParser[T]); ok {
+		n.Rule = named.name
+	}
+	ids := b.st.childIDs(id)
+	if len(ids) > 0 {
+		k := len(b.children)
+		b.children = b.children[:k+len(ids)]
+		n.Children = b.children[k : k+len(ids) : k+len(ids)]
+		for i, c := range ids {
+			n.Children[i] = b.build(c)
+		}
+	}
+	return n
+}
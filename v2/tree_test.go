@@ -0,0 +1,90 @@
+package packrat
+
+import (
+	"testing"
+)
+
+func TestParseTree(t *testing.T) {
+	// nil callbacks are fine, they never run
+	num := NewNamedParser[any]("num", NewRegexParser[any](nil, `[0-9]+`, false, true))
+	expr := NewOrParser[any]()
+	sum := NewNamedParser[any]("sum", NewAndParser[any](nil, expr, NewAtomParser[any](nil, "+", false, true), num))
+	expr.Set(sum, num)
+	list := NewKleeneParser[any](nil, expr, NewAtomParser[any](nil, ";", false, true))
+
+	tree, err := ParseTree[any](list, NewScanner[any]("1 + 2 + 3; 4", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Kleene(Or(sum(And(Or(sum(And(Or(num(/[0-9]+/ "1")) "+" "+" num(/[0-9]+/ "2")))) "+" "+" num(/[0-9]+/ "3")))) ";" ";" Or(num(/[0-9]+/ "4")))`
+	if tree.String() != expected {
+		t.Errorf("unexpected tree\n%s\n%s", tree, expected)
+	}
+	outer := tree.Children[0].Children[0]
+	if outer.Rule != "sum" || outer.Text() != "1 + 2 + 3" || outer.Span.Start != 0 || outer.Span.End != 9 {
+		t.Errorf("unexpected node %s %q %d-%d", outer.Rule, outer.Text(), outer.Span.Start, outer.Span.End)
+	}
+
+	if _, err := ParseTree[any](list, NewScanner[any]("1 + ; 2", SkipWhitespaceRegex)); err == nil || err.Position != 2 {
+		t.Errorf("expected an error at position 2, got %v", err)
+	}
+}
+
+func TestParseTreeNoMemo(t *testing.T) {
+	// items and separators of NoMemo lists get nodes like memoized ones
+	ident := NewNamedParser[any]("ident", NewRegexParser[any](nil, `[a-z]+`, false, true))
+	list := NewKleeneParser[any](nil, ident, NewAtomParser[any](nil, ",", false, true))
+	memo, err := ParseTree[any](list, NewScanner[any]("a , b,c", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.NoMemo = true
+	tree, err := ParseTree[any](list, NewScanner[any]("a , b,c", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Kleene(ident(/[a-z]+/ "a") "," "," ident(/[a-z]+/ "b") "," "," ident(/[a-z]+/ "c"))`
+	if tree.String() != expected || memo.String() != expected {
+		t.Errorf("unexpected tree\n%s\n%s\n%s", tree, memo, expected)
+	}
+	if sep := tree.Children[1]; sep.Span.Start != 2 || sep.Span.End != 3 {
+		t.Errorf("unexpected separator span %d-%d", sep.Span.Start, sep.Span.End)
+	}
+}
+
+func TestParseTreeBacktracking(t *testing.T) {
+	// alternatives and candidates that lose leave no nodes behind
+	ident := NewRegexParser[any](nil, `[a-z]+`, false, true)
+	call := NewNamedParser[any]("call", NewAndParser[any](nil, ident, NewAtomParser[any](nil, "(", false, true), NewAtomParser[any](nil, ")", false, true)))
+	assign := NewNamedParser[any]("assign", NewAndParser[any](nil, ident, NewAtomParser[any](nil, "=", false, true), NewOrParser[any](call, ident)))
+	longest := NewLongestParser[any](NewAtomParser[any](nil, "<", false, true), NewAtomParser[any](nil, "<=", false, true))
+	cmp := NewNamedParser[any]("cmp", NewAndParser[any](nil, ident, longest, ident))
+	stmt := NewOrParser[any](assign, cmp)
+	list := NewManyParser[any](nil, stmt, NewAtomParser[any](nil, ",", false, true))
+
+	tree, err := ParseTree[any](list, NewScanner[any]("a = b, c <= d, e = f()", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Many(Or(assign(And(/[a-z]+/ "a" "=" "=" Or(/[a-z]+/ "b")))) "," "," Or(cmp(And(/[a-z]+/ "c" Longest("<=" "<=") /[a-z]+/ "d"))) "," "," Or(assign(And(/[a-z]+/ "e" "=" "=" Or(call(And(/[a-z]+/ "f" "(" "(" ")" ")")))))))`
+	if tree.String() != expected {
+		t.Errorf("unexpected tree\n%s\n%s", tree, expected)
+	}
+}
+
+func TestParseTreeEmbedded(t *testing.T) {
+	inner := NewManyParser[any](nil, NewRegexParser[any](nil, `[a-z]+`, false, true), NewAtomParser[any](nil, ".", false, false))
+	path := NewEmbedParser[any](inner, nil)
+	path.SetRegion(NewRegexParser[any](nil, `'(?:[^']|'')*'`, false, true), UnquoteDoubled('\''))
+	p := NewAndParser[any](nil, NewAtomParser[any](nil, "GET", false, true), path)
+
+	tree, err := ParseTree[any](p, NewScanner[any]("GET 'a.bc'", SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// spans refer to the host input
+	leaf := tree.Children[1].Children[0].Children[2]
+	if leaf.Text() != "bc" || leaf.Span.Start != 7 {
+		t.Errorf("unexpected leaf %q at %d in %s", leaf.Text(), leaf.Span.Start, tree)
+	}
+}
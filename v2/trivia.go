@@ -0,0 +1,174 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"strings"
+)
+
+// Trivia is a piece of input that is not part of any token: whitespace or a
+// comment skipped by the skipper.
+type Trivia struct {
+	// Kind is "whitespace", the prefix of a line comment or the opening of
+	// a block comment (see NewLineCommentSkipper and
+	// NewBlockCommentSkipper), or "" for input the skipper does not
+	// classify, like the quotes around an embedded region
+	Kind string
+	Span Span
+}
+
+// Text returns the source text of the trivia.
+func (t Trivia) Text() string {
+	return t.Span.Text()
+}
+
+// ParseTreeTrivia is like ParseTree, but additionally attaches all input
+// between tokens to the tokens (leaves with text) as trivia: trivia on the
+// line of a token up to and including the line break is Trailing of that
+// token, the rest is Leading of the next one. Input before the first token
+// is Leading of it, input after the last token Trailing. So FullText of the
+// tree reproduces the input byte-for-byte.
+func ParseTreeTrivia[T any](p Parser[T], s *Scanner[T]) (*SyntaxNode[T], *ParserError[T]) {
+	tree, err := ParseTree(p, s)
+	if err != nil {
+		return nil, err
+	}
+	tree.attachTrivia(s.skipper)
+	return tree, nil
+}
+
+// FullText returns the text of the node including the trivia of its tokens.
+func (n *SyntaxNode[T]) FullText() string {
+	var b strings.Builder
+	n.writeFullText(&b)
+	return b.String()
+}
+
+func (n *SyntaxNode[T]) writeFullText(b *strings.Builder) {
+	for _, t := range n.Leading {
+		b.WriteString(t.Text())
+	}
+	if len(n.Children) == 0 {
+		b.WriteString(n.Text())
+	}
+	for _, c := range n.Children {
+		c.writeFullText(b)
+	}
+	for _, t := range n.Trailing {
+		b.WriteString(t.Text())
+	}
+}
+
+// tokens appends the leaves with text in source order.
+func (n *SyntaxNode[T]) tokens(tokens []*SyntaxNode[T]) []*SyntaxNode[T] {
+	if len(n.Children) == 0 {
+		if n.Span.End > n.Span.Start {
+			tokens = append(tokens, n)
+		}
+		return tokens
+	}
+	for _, c := range n.Children {
+		tokens = c.tokens(tokens)
+	}
+	return tokens
+}
+
+func (n *SyntaxNode[T]) attachTrivia(skipper Skipper) {
+	source := n.Span.source
+	tokens := n.tokens(nil)
+	if len(tokens) == 0 {
+		n.Leading = splitTrivia(skipper, source, 0, len(source))
+		return
+	}
+	pos := 0
+	for i, tok := range tokens {
+		pieces := splitTrivia(skipper, source, pos, tok.Span.Start)
+		if i > 0 {
+			tokens[i-1].Trailing, pieces = splitLine(pieces)
+		}
+		tok.Leading = pieces
+		pos = tok.Span.End
+	}
+	tokens[len(tokens)-1].Trailing = splitTrivia(skipper, source, pos, len(source))
+}
+
+// splitLine splits trivia after the first line break. Line breaks inside
+// block comments do not count since they do not end the line of the token in
+// front of the comment.
+func splitLine(pieces []Trivia) (line, rest []Trivia) {
+	for i, t := range pieces {
+		text := t.Text()
+		if strings.HasSuffix(text, "\n") && t.Kind != "whitespace" && t.Kind != "" {
+			// a line comment including its line break
+			return pieces[: i+1 : i+1], pieces[i+1:]
+		}
+		if t.Kind != "whitespace" && t.Kind != "" {
+			continue
+		}
+		k := strings.IndexByte(text, '\n')
+		if k < 0 {
+			continue
+		}
+		cut := t.Span.Start + k + 1
+		line = append(pieces[:i:i], Trivia{Kind: t.Kind, Span: Span{Start: t.Span.Start, End: cut, source: t.Span.source, lines: t.Span.lines}})
+		rest = pieces[i+1:]
+		if cut < t.Span.End {
+			rest = append([]Trivia{{Kind: t.Kind, Span: Span{Start: cut, End: t.Span.End, source: t.Span.source, lines: t.Span.lines}}}, rest...)
+		}
+		return line, rest
+	}
+	return pieces, nil
+}
+
+// splitTrivia splits source[pos:end] into pieces of trivia.
+func splitTrivia(skipper Skipper, source string, pos, end int) []Trivia {
+	var result []Trivia
+	input := source[:end]
+	for pos < end {
+		kind, n := classifyTrivia(skipper, input, pos)
+		if n <= 0 {
+			// not skippable, up to the next trivia the skipper knows
+			n = 1
+			for pos+n < end {
+				if _, m := classifyTrivia(skipper, input, pos+n); m > 0 {
+					break
+				}
+				n++
+			}
+			kind = ""
+		}
+		if kind == "" && strings.Trim(input[pos:pos+n], " \t\r\n") == "" {
+			kind = "whitespace"
+		}
+		result = append(result, Trivia{Kind: kind, Span: Span{Start: pos, End: pos + n, source: source}})
+		pos += n
+	}
+	return result
+}
+
+// classifyTrivia returns the kind and length of the trivia at pos.
+func classifyTrivia(skipper Skipper, input string, pos int) (string, int) {
+	switch sk := skipper.(type) {
+	case nil:
+		return "", 0
+	case whitespaceSkipper:
+		return "whitespace", sk.Skip(input, pos)
+	case *lineCommentSkipper:
+		return sk.prefix, sk.Skip(input, pos)
+	case *blockCommentSkipper:
+		return sk.open, sk.Skip(input, pos)
+	case *combinedSkipper:
+		for _, c := range sk.skippers {
+			if kind, n := classifyTrivia(c, input, pos); n > 0 {
+				return kind, n
+			}
+		}
+		return "", 0
+	}
+	return "", skipper.Skip(input, pos)
+}
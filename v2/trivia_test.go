@@ -0,0 +1,75 @@
+package packrat
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func triviaString(trivia []Trivia) string {
+	var parts []string
+	for _, t := range trivia {
+		parts = append(parts, fmt.Sprintf("%s:%q", t.Kind, t.Text()))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestParseTreeTrivia(t *testing.T) {
+	ident := NewRegexParser[any](nil, `[a-z]+`, false, true)
+	columns := NewManyParser[any](nil, ident, NewAtomParser[any](nil, ",", false, true))
+	query := NewAndParser[any](nil, NewAtomParser[any](nil, "SELECT", true, true), columns, NewAtomParser[any](nil, "FROM", true, true), ident)
+
+	input := "-- header\n  SELECT a, /* the b\n  column */ b -- trailing\n\tFROM t  /* end */\n"
+	s := NewScanner[any](input, nil)
+	s.SetSkipper(SQLSkipper)
+	tree, err := ParseTreeTrivia[any](query, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.FullText() != input {
+		t.Errorf("the input should round-trip\n%q\n%q", tree.FullText(), input)
+	}
+
+	var got []string
+	for _, tok := range tree.tokens(nil) {
+		got = append(got, fmt.Sprintf("%s %q %s", triviaString(tok.Leading), tok.Text(), triviaString(tok.Trailing)))
+	}
+	expected := []string{
+		`[--:"-- header\n" whitespace:"  "] "SELECT" [whitespace:" "]`,
+		`[] "a" []`,
+		`[] "," [whitespace:" " /*:"/* the b\n  column */" whitespace:" "]`,
+		`[] "b" [whitespace:" " --:"-- trailing\n"]`,
+		`[whitespace:"\t"] "FROM" [whitespace:" "]`,
+		`[] "t" [whitespace:"  " /*:"/* end */" whitespace:"\n"]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected trivia\n%s\n\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestParseTreeTriviaEmbedded(t *testing.T) {
+	// the quotes of the region are not part of a token, but kept as trivia
+	inner := NewRegexParser[any](nil, `[a-z]+`, false, true)
+	str := NewEmbedParser[any](inner, nil)
+	str.SetRegion(NewRegexParser[any](nil, `'[^']*'`, false, true), UnquoteDoubled('\''))
+	p := NewKleeneParser[any](nil, str, NewAtomParser[any](nil, ",", false, true))
+
+	input := " 'ab' ,\n'cd'"
+	tree, err := ParseTreeTrivia[any](p, NewScanner[any](input, SkipWhitespaceRegex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.FullText() != input {
+		t.Errorf("the input should round-trip\n%q\n%q", tree.FullText(), input)
+	}
+	toks := tree.tokens(nil)
+	if s := triviaString(toks[0].Leading); s != `[whitespace:" " :"'"]` {
+		t.Errorf("unexpected trivia %s", s)
+	}
+
+	// without any token, the whole input is trivia of the root
+	empty, err := ParseTreeTrivia[any](p, NewScanner[any]("  ", SkipWhitespaceRegex))
+	if err != nil || empty.FullText() != "  " {
+		t.Errorf("unexpected result %v %v", empty, err)
+	}
+}
@@ -0,0 +1,82 @@
+package packrat
+
+import (
+	"strconv"
+	"testing"
+)
+
+type testCatalog struct {
+	tables map[string]int
+	calls  int
+}
+
+func TestUserData(t *testing.T) {
+	// the grammar is built once and shared, the catalog differs per parse
+	table := NewRegexParser(func(s string) int { return -1 }, `[a-z]+`, false, true)
+	table.SetContextCallback(func(ctx Context[int], name string) (int, error) {
+		c := ctx.Scanner.UserData.(*testCatalog)
+		c.calls++
+		return c.tables[name], nil
+	})
+	sum := NewManyParser(func(s string, a ...int) int { return -1 }, table, NewAtomParser(0, ",", false, true))
+	sum.SetContextCallback(func(ctx Context[int], match string, a ...int) (int, error) {
+		ctx.Scanner.UserData.(*testCatalog).calls++
+		r := 0
+		for _, v := range a {
+			r += v
+		}
+		return r, nil
+	})
+	query := NewAndParser(func(s string, a ...int) int { return a[1] }, NewAtomParser(0, "FROM", true, true), sum)
+
+	s := NewScanner[int]("FROM a, b", SkipWhitespaceRegex)
+	for i := 1; i <= 3; i++ {
+		c := &testCatalog{tables: map[string]int{"a": i, "b": 10 * i}}
+		s.Reset("FROM a, b", SkipWhitespaceRegex)
+		s.UserData = c
+		n, err := Parse[int](query, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Payload != 11*i {
+			t.Errorf("parse %d: unexpected payload %d", i, n.Payload)
+		}
+		if c.calls != 3 {
+			t.Errorf("parse %d: expected 3 callback calls, got %d", i, c.calls)
+		}
+	}
+}
+
+func TestUserDataEmbedded(t *testing.T) {
+	inner := NewRegexParser(func(s string) string { return s }, `[0-9]+`, false, true)
+	inner.SetContextCallback(func(ctx Context[string], match string) (string, error) {
+		return ctx.Scanner.UserData.(string) + match, nil
+	})
+	embed := NewEmbedParser[string](inner, nil)
+	embed.SetRegion(NewRegexParser(func(s string) string { return s }, `'[^']*'`, false, true), UnquoteDoubled('\''))
+	s := NewScanner[string]("'42'", SkipWhitespaceRegex)
+	s.UserData = "#"
+	n, err := Parse[string](embed, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != "#42" {
+		t.Errorf("embedded scanner should share the user data, got %q", n.Payload)
+	}
+}
+
+func TestUserDataCallbackVariants(t *testing.T) {
+	// the context callback replaces the one of the constructor
+	p := NewKleeneParser(func(s string, a ...string) string { return "plain" }, NewAtomParser("", "x", false, false), nil)
+	n, _ := Parse[string](p, NewScanner[string]("xx", nil))
+	if n.Payload != "plain" {
+		t.Errorf("unexpected payload %q", n.Payload)
+	}
+	p.SetContextCallback(func(ctx Context[string], s string, a ...string) (string, error) {
+		return "context " + strconv.Itoa(len(a)) + " " + strconv.Itoa(ctx.Span.End), nil
+	})
+	n, _ = Parse[string](p, NewScanner[string]("xx", nil))
+	if n.Payload != "context 2 2" {
+		t.Errorf("unexpected payload %q", n.Payload)
+	}
+}
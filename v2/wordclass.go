@@ -0,0 +1,107 @@
+/*
+	(c) 2026 Launix, Inh. Carl-Philip Hänsch
+	Author: Carl-Philip Hänsch
+
+	Dual licensed with custom aggreements or GPLv3
+*/
+
+package packrat
+
+import (
+	"unicode/utf8"
+)
+
+// WordClass defines which characters form words. Atom and regex parsers with
+// skipWs only match between word boundaries, so with the default class the
+// atom "SEL" does not match inside "SELECT".
+//
+// A WordClass is immutable once built and can be shared by any number of
+// scanners. ASCII characters are looked up in a table, all other runes are
+// passed to a predicate.
+type WordClass struct {
+	ascii    [utf8.RuneSelf]bool
+	nonASCII func(rune) bool
+}
+
+// DefaultWordClass treats letters, digits and connector punctuation (such as
+// '_') as word characters.
+var DefaultWordClass = NewWordClass(isDefaultWordChar)
+
+// NewWordClass builds a word class from a rune predicate. The predicate is
+// evaluated once for all ASCII characters.
+func NewWordClass(isWord func(rune) bool) *WordClass {
+	c := &WordClass{nonASCII: isWord}
+	for r := rune(0); r < utf8.RuneSelf; r++ {
+		c.ascii[r] = isWord(r)
+	}
+	return c
+}
+
+// NewWordClassTable builds a word class from a table for ASCII characters and
+// a predicate for all other runes. nonASCII may be nil if no other rune is a
+// word character.
+func NewWordClassTable(ascii [utf8.RuneSelf]bool, nonASCII func(rune) bool) *WordClass {
+	return &WordClass{ascii: ascii, nonASCII: nonASCII}
+}
+
+// With returns a copy of the word class that additionally treats the given
+// characters as word characters, e.g. DefaultWordClass.With("$") for PHP
+// variables, With("-") for CSS identifiers or With("@") for MySQL variables.
+func (c *WordClass) With(chars string) *WordClass {
+	result := *c
+	var extra []rune
+	for _, r := range chars {
+		if r < utf8.RuneSelf {
+			result.ascii[r] = true
+		} else {
+			extra = append(extra, r)
+		}
+	}
+	if len(extra) > 0 {
+		inner := c.nonASCII
+		result.nonASCII = func(r rune) bool {
+			for _, e := range extra {
+				if r == e {
+					return true
+				}
+			}
+			return inner != nil && inner(r)
+		}
+	}
+	return &result
+}
+
+// IsWord reports whether r is a word character.
+func (c *WordClass) IsWord(r rune) bool {
+	if r >= 0 && r < utf8.RuneSelf {
+		return c.ascii[r]
+	}
+	return c.nonASCII != nil && c.nonASCII(r)
+}
+
+// markBreaks marks every position of input where a word starts or ends, as
+// well as all non-word characters and the end of input. breaks must be sized
+// len(input)+1 and cleared.
+func (c *WordClass) markBreaks(input string, breaks []bool) {
+	previousWord := false
+	for pos := 0; pos < len(input); {
+		b := input[pos]
+		var currentWord bool
+		if b < utf8.RuneSelf {
+			currentWord = c.ascii[b]
+			if !currentWord || !previousWord {
+				breaks[pos] = true
+			}
+			pos++
+		} else {
+			r, size := utf8.DecodeRuneInString(input[pos:])
+			currentWord = c.nonASCII != nil && c.nonASCII(r)
+			if !currentWord || !previousWord {
+				breaks[pos] = true
+			}
+			pos += size
+		}
+		previousWord = currentWord
+	}
+	breaks[len(input)] = true
+}
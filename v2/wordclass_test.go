@@ -0,0 +1,75 @@
+package packrat
+
+import "testing"
+
+func TestWordClassDollar(t *testing.T) {
+	variable := NewRegexParser(func(s string) string { return s }, `\$[a-z]+`, false, true)
+
+	scanner := NewScanner[string]("$var", SkipWhitespaceRegex)
+	scanner.SetWordClass(DefaultWordClass.With("$"))
+	n, err := Parse[string](variable, scanner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != "$var" {
+		t.Errorf("unexpected payload %q", n.Payload)
+	}
+
+	// "$" is a word character now, so "var" alone is no word of its own
+	plain := NewAtomParser("var", "var", false, true)
+	scanner = NewScanner[string]("a$var", SkipWhitespaceRegex)
+	scanner.SetWordClass(DefaultWordClass.With("$"))
+	scanner.move(2)
+	if _, err := ParsePartial[string](plain, scanner); err == nil {
+		t.Error("var should not match inside $var")
+	}
+}
+
+func TestWordClassHyphenAndAt(t *testing.T) {
+	css := DefaultWordClass.With("-")
+	scanner := NewScanner[int]("foo-bar baz", nil)
+	scanner.SetWordClass(css)
+	if scanner.breaks[3] || scanner.breaks[4] {
+		t.Error("foo-bar should be a single word")
+	}
+	if !scanner.breaks[7] || !scanner.breaks[8] {
+		t.Error("space and baz should start new words")
+	}
+
+	mysql := DefaultWordClass.With("@")
+	session := NewAtomParser(1, "@@session", true, true)
+	scanner = NewScanner[int]("@@SESSION", nil)
+	scanner.SetWordClass(mysql)
+	if _, err := Parse[int](session, scanner); err != nil {
+		t.Error(err)
+	}
+	scanner = NewScanner[int]("@@sessions", nil)
+	scanner.SetWordClass(mysql)
+	if _, err := Parse[int](session, scanner); err == nil {
+		t.Error("@@session should not match a prefix of @@sessions")
+	}
+}
+
+func TestWordClassTable(t *testing.T) {
+	var ascii [128]bool
+	for c := 'a'; c <= 'z'; c++ {
+		ascii[c] = true
+	}
+	lower := NewWordClassTable(ascii, nil)
+	if !lower.IsWord('q') || lower.IsWord('Q') || lower.IsWord('ü') {
+		t.Error("table word class classifies wrongly")
+	}
+	greek := DefaultWordClass.With("§")
+	if !greek.IsWord('§') || !greek.IsWord('λ') || greek.IsWord('+') {
+		t.Error("extended word class classifies wrongly")
+	}
+}
+
+func TestWordClassKeptOnReset(t *testing.T) {
+	scanner := NewScanner[int]("a-b", nil)
+	scanner.SetWordClass(DefaultWordClass.With("-"))
+	scanner.Reset("c-d", nil)
+	if scanner.breaks[1] || scanner.breaks[2] {
+		t.Error("word class should survive Reset")
+	}
+}